@@ -0,0 +1,176 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hdsctl
+
+import (
+	"fmt"
+	"github.com/frnckdlprt/hdsctl/waveform"
+	"math"
+	"strings"
+)
+
+// AcquireMode is a host side acquisition mode, combining consecutive frames of the scope.
+type AcquireMode int
+
+const (
+	AcquireSample AcquireMode = iota
+	AcquireAverage
+	AcquireEnvelope
+)
+
+func ParseAcquireMode(s string) (AcquireMode, error) {
+	switch strings.ToLower(s) {
+	case "sample", "":
+		return AcquireSample, nil
+	case "average", "avg":
+		return AcquireAverage, nil
+	case "envelope", "env":
+		return AcquireEnvelope, nil
+	}
+	return 0, fmt.Errorf("invalid acquire mode: %s", s)
+}
+
+// Accumulator keeps the last Count frames to compute their running average or min/max envelope.
+// Frames are discarded when the acquisition settings, such as a scale or the time base, change.
+type Accumulator struct {
+	Mode   AcquireMode
+	Count  int
+	frames []*Frame
+}
+
+// Add accumulates the frame, and returns true when the previous frames were discarded.
+func (a *Accumulator) Add(frame *Frame) bool {
+	reset := len(a.frames) > 0 && !a.frames[0].Header.SameSettings(frame.Header)
+	if reset {
+		a.Reset()
+	}
+	a.frames = append(a.frames, frame)
+	if a.Count > 0 && len(a.frames) > a.Count {
+		a.frames = a.frames[len(a.frames)-a.Count:]
+	}
+	return reset
+}
+
+func (a *Accumulator) Reset() {
+	a.frames = nil
+}
+
+// Len returns the number of accumulated frames.
+func (a *Accumulator) Len() int {
+	return len(a.frames)
+}
+
+// Frames returns the result of the accumulation as frames with the header of the last one: the average frame,
+// whose Volts are not rounded like its raw samples, or the min and max frames of the envelope. In sample mode,
+// it is the last frame.
+func (a *Accumulator) Frames() ([]*Frame, error) {
+	if len(a.frames) == 0 {
+		return nil, fmt.Errorf("no frame accumulated")
+	}
+	last := a.frames[len(a.frames)-1]
+	if a.Mode == AcquireSample {
+		return []*Frame{last}, nil
+	}
+	result := []*Frame{}
+	for _, f := range a.combine() {
+		frame := &Frame{Seq: last.Seq, Timestamp: last.Timestamp, Header: last.Header, Waves: map[int][]int8{}}
+		for ch, raw := range f {
+			wave := make([]int8, len(raw))
+			for i, v := range raw {
+				wave[i] = int8(math.Max(math.MinInt8, math.Min(math.MaxInt8, math.Round(v))))
+			}
+			frame.Waves[ch] = wave
+		}
+		if a.Mode == AcquireAverage {
+			frame.volts = map[int][]float64{}
+			for ch := range f {
+				ws, err := a.Waveforms(ch)
+				if err != nil {
+					return nil, err
+				}
+				frame.volts[ch] = ws[0].Samples
+			}
+		}
+		result = append(result, frame)
+	}
+	return result, nil
+}
+
+// Waveforms returns the accumulated channel in volts, without the rounding of the raw samples:
+// the average, or the min and max of the envelope.
+func (a *Accumulator) Waveforms(ch int) ([]*waveform.Waveform, error) {
+	if len(a.frames) == 0 {
+		return nil, fmt.Errorf("no frame accumulated")
+	}
+	last := a.frames[len(a.frames)-1]
+	template, err := last.Waveform(ch)
+	if err != nil {
+		return nil, err
+	}
+	if a.Mode == AcquireSample {
+		return []*waveform.Waveform{template}, nil
+	}
+	hc, err := last.Header.Channel(ch)
+	if err != nil {
+		return nil, err
+	}
+	vpu, err := hc.VoltsPerUnit()
+	if err != nil {
+		return nil, err
+	}
+	names := []string{"avg"}
+	if a.Mode == AcquireEnvelope {
+		names = []string{"min", "max"}
+	}
+	result := []*waveform.Waveform{}
+	for i, f := range a.combine() {
+		w := *template
+		w.Name = fmt.Sprintf("%s_%s", template.Name, names[i])
+		w.Samples = make([]float64, len(f[ch]))
+		for j, v := range f[ch] {
+			w.Samples[j] = (v - hc.Offset) * vpu
+		}
+		result = append(result, &w)
+	}
+	return result, nil
+}
+
+// combine returns the raw samples of the channels of the last frame, averaged, or their min and max
+func (a *Accumulator) combine() []map[int][]float64 {
+	last := a.frames[len(a.frames)-1]
+	avg, min, max := map[int][]float64{}, map[int][]float64{}, map[int][]float64{}
+	for ch, wave := range last.Waves {
+		avg[ch], min[ch], max[ch] = make([]float64, len(wave)), make([]float64, len(wave)), make([]float64, len(wave))
+		for i := range wave {
+			min[ch][i], max[ch][i] = math.Inf(1), math.Inf(-1)
+		}
+		for _, f := range a.frames {
+			for i, v := range f.Waves[ch] {
+				if i >= len(wave) {
+					break
+				}
+				avg[ch][i] += float64(v) / float64(len(a.frames))
+				min[ch][i] = math.Min(min[ch][i], float64(v))
+				max[ch][i] = math.Max(max[ch][i], float64(v))
+			}
+		}
+	}
+	if a.Mode == AcquireEnvelope {
+		return []map[int][]float64{min, max}
+	}
+	return []map[int][]float64{avg}
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/frnckdlprt/hdsctl"
+	"io"
+	"os"
+	"time"
+)
+
+// Version of the .hds archive format, archives written by a newer version are rejected
+const Version = 1
+
+const manifestName = "manifest.json"
+const framesName = "frames.ndjson"
+
+// Capture is the content of a .hds archive: the frames, with their typed header and raw samples,
+// along with the instrument context at the time of the capture.
+type Capture struct {
+	Version     int               `json:"version"`
+	IDN         string            `json:"idn"`
+	Created     time.Time         `json:"created"`
+	Fields      map[string]string `json:"fields"`
+	Annotations []Annotation      `json:"annotations"`
+	Frames      []*hdsctl.Frame   `json:"-"`
+}
+
+// Annotation is a note attached to the capture, or to a frame (Seq), channel and time when set.
+type Annotation struct {
+	Seq     uint64  `json:"seq,omitempty"`
+	Channel int     `json:"channel,omitempty"`
+	Time    float64 `json:"time,omitempty"`
+	Text    string  `json:"text"`
+}
+
+func New(frames []*hdsctl.Frame) *Capture {
+	return &Capture{Version: Version, Created: time.Now(), Fields: map[string]string{}, Annotations: []Annotation{}, Frames: frames}
+}
+
+// FromHDS creates a capture of the frames along with the current field values of the scope.
+func FromHDS(hds *hdsctl.HDS, frames []*hdsctl.Frame) *Capture {
+	c := New(frames)
+	c.Fields = hds.GetFields()
+	c.IDN = c.Fields["idn"]
+	return c
+}
+
+func (c *Capture) Annotate(a Annotation) {
+	c.Annotations = append(c.Annotations, a)
+}
+
+func Write(w io.Writer, c *Capture) error {
+	zw := zip.NewWriter(w)
+	mw, err := zw.Create(manifestName)
+	if err != nil {
+		return fmt.Errorf("failed to create manifest: %w", err)
+	}
+	if err := json.NewEncoder(mw).Encode(c); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	fw, err := zw.Create(framesName)
+	if err != nil {
+		return fmt.Errorf("failed to create frames: %w", err)
+	}
+	sw := hdsctl.NewSegmentWriter(fw)
+	for _, frame := range c.Frames {
+		if err := sw.Write(frame); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func Read(r io.ReaderAt, size int64) (c *Capture, err error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive: %w", err)
+	}
+	mr, err := zr.Open(manifestName)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive: %w", err)
+	}
+	defer mr.Close()
+	c = &Capture{}
+	if err := json.NewDecoder(mr).Decode(c); err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	if c.Version < 1 || c.Version > Version {
+		return nil, fmt.Errorf("unsupported archive version: %v", c.Version)
+	}
+	fr, err := zr.Open(framesName)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive: %w", err)
+	}
+	defer fr.Close()
+	err = hdsctl.ReadSegments(fr, func(frame *hdsctl.Frame) error {
+		c.Frames = append(c.Frames, frame)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func WriteFile(path string, c *Capture) error {
+	buff := &bytes.Buffer{}
+	if err := Write(buff, c); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buff.Bytes(), 0644)
+}
+
+func ReadFile(path string) (c *Capture, err error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return Read(bytes.NewReader(b), int64(len(b)))
+}
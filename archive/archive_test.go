@@ -0,0 +1,89 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package archive
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/frnckdlprt/hdsctl"
+	"github.com/frnckdlprt/hdsctl/scpi"
+	"testing"
+)
+
+func assertNilErr(t *testing.T, err error) {
+	if err != nil {
+		t.Fatalf("error unexpected: %v", err)
+	}
+}
+
+func Test_archive(t *testing.T) {
+	hds := hdsctl.NewHDS(scpi.NewHDSClient(scpi.NewMockExecutor()))
+	frame, err := hds.Acquire()
+	assertNilErr(t, err)
+	c := New([]*hdsctl.Frame{frame})
+	c.IDN = "mock"
+	c.Fields["ch1Disp"] = "ON"
+	c.Annotate(Annotation{Seq: frame.Seq, Channel: 1, Text: "glitch"})
+	buff := &bytes.Buffer{}
+	assertNilErr(t, Write(buff, c))
+
+	read, err := Read(bytes.NewReader(buff.Bytes()), int64(buff.Len()))
+	assertNilErr(t, err)
+	if read.IDN != "mock" || read.Annotations[0].Text != "glitch" || len(read.Frames) != 1 {
+		t.Fatalf("unexpected capture: %+v", read)
+	}
+
+	replay := hdsctl.NewHDS(scpi.NewHDSClient(NewReplayExecutor(read)))
+	replayed, err := replay.Acquire()
+	assertNilErr(t, err)
+	if fmt.Sprint(replayed.Waves) != fmt.Sprint(frame.Waves) || !replayed.Header.SameSettings(frame.Header) {
+		t.Fatalf("unexpected replayed frame: %v", replayed)
+	}
+	v, err := replay.GetField("ch1Disp")
+	assertNilErr(t, err)
+	if v != "ON" {
+		t.Fatalf("unexpected replayed field: %v", v)
+	}
+}
+
+func Test_replay(t *testing.T) {
+	hds := hdsctl.NewHDS(scpi.NewHDSClient(scpi.NewMockExecutor()))
+	first, err := hds.Acquire()
+	assertNilErr(t, err)
+	second := *first
+	second.Waves = map[int][]int8{1: {1, 2, 3}}
+	re := NewReplayExecutor(New([]*hdsctl.Frame{first, &second}))
+	read := func(name string) []byte {
+		b, err := re.Execute(scpi.Command{Definition: &scpi.CommandDefinition{Name: name}})
+		assertNilErr(t, err)
+		return b
+	}
+	// the channels and the closing header of an acquisition come from the frame of its first header
+	read(":DATa:WAVe:SCReen:HEAD")
+	re.start = re.start.Add(-replayFrameDuration)
+	if b := read(":DATa:WAVe:SCReen:CH1"); len(b) != 4+len(first.Waves[1]) {
+		t.Fatalf("unexpected replayed wave: %v", b)
+	}
+	read(":DATa:WAVe:SCReen:HEAD")
+	if re.frame != first {
+		t.Fatal("expected the same frame until the next acquisition")
+	}
+	read(":DATa:WAVe:SCReen:HEAD")
+	if b := read(":DATa:WAVe:SCReen:CH1"); fmt.Sprint(b) != "[0 0 0 0 1 2 3]" {
+		t.Fatalf("unexpected wave of the next frame: %v", b)
+	}
+}
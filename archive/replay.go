@@ -0,0 +1,92 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package archive
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/frnckdlprt/hdsctl"
+	"github.com/frnckdlprt/hdsctl/scpi"
+	"strings"
+	"sync"
+	"time"
+)
+
+const replayFrameDuration = time.Second
+
+// ReplayExecutor answers scpi queries from a capture, so that it can be served without a scope
+// attached. Settings are ignored, and the frames are replayed in a loop.
+//
+// Screen reads are expected in the order of HDS.Acquire: a header, the channels, then the header
+// again. Two header reads in a row start a new acquisition, so a header read on its own, as by
+// HDS.GetHeader, also picks the current frame. The executor is safe for concurrent use, but the
+// reads of concurrent acquisitions must not interleave, which HDS.Acquire ensures.
+type ReplayExecutor struct {
+	capture *Capture
+	start   time.Time
+	mx      sync.Mutex
+	// frame of the current acquisition, picked on the header read starting it, and served to the
+	// channel reads and to the header read ending it
+	frame    *hdsctl.Frame
+	lastHead bool
+}
+
+func NewReplayExecutor(c *Capture) *ReplayExecutor {
+	return &ReplayExecutor{capture: c, start: time.Now()}
+}
+
+func (re *ReplayExecutor) Execute(cmd scpi.Command) (result []byte, err error) {
+	if len(cmd.Arguments) > 0 {
+		return nil, nil
+	}
+	name := cmd.Definition.Name
+	if strings.HasPrefix(name, ":DATa:WAVe:SCReen:") {
+		if len(re.capture.Frames) == 0 {
+			return nil, fmt.Errorf("no frame in capture")
+		}
+		head := name == ":DATa:WAVe:SCReen:HEAD"
+		frame := re.screenFrame(head)
+		if head {
+			return json.Marshal(frame.Header)
+		}
+		var ch int
+		fmt.Sscanf(name, ":DATa:WAVe:SCReen:CH%d", &ch)
+		// screen data is prefixed by a 4 bytes length
+		result = []byte{0, 0, 0, 0}
+		for _, s := range frame.Waves[ch] {
+			result = append(result, byte(s))
+		}
+		return result, nil
+	}
+	v, ok := re.capture.Fields[cmd.Definition.Id]
+	if !ok {
+		return nil, fmt.Errorf("no value for: %v", name)
+	}
+	return []byte(v), nil
+}
+
+// screenFrame returns the frame of the acquisition the screen read belongs to
+func (re *ReplayExecutor) screenFrame(head bool) *hdsctl.Frame {
+	re.mx.Lock()
+	defer re.mx.Unlock()
+	if re.frame == nil || (head && re.lastHead) {
+		i := int(time.Since(re.start)/replayFrameDuration) % len(re.capture.Frames)
+		re.frame = re.capture.Frames[i]
+	}
+	re.lastHead = head
+	return re.frame
+}
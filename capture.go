@@ -0,0 +1,114 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hdsctl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	triggerPollInterval = 50 * time.Millisecond
+	// longest time for a stopped scope to run again in auto sweep mode before arming
+	rearmTimeout = time.Second
+)
+
+var ErrTriggerTimeout = errors.New("timeout waiting for trigger")
+
+// Arm sets the single sweep mode, the scope then waits for the next trigger. A scope still
+// stopped on a previous shot is first switched to the auto sweep mode until it runs, so that
+// any TRIG or STOP status read after arming is the new trigger.
+func (hds *HDS) Arm() error {
+	status, err := hds.triggerStatus()
+	if err != nil {
+		return err
+	}
+	if triggered(status) {
+		if err := hds.Client.Set(":TRIGger:SINGle:SWEep AUTO"); err != nil {
+			return fmt.Errorf("failed to rearm trigger: %w", err)
+		}
+		for start := time.Now(); triggered(status); {
+			if time.Since(start) > rearmTimeout {
+				return fmt.Errorf("failed to rearm trigger: scope still in %s", status)
+			}
+			time.Sleep(triggerPollInterval)
+			if status, err = hds.triggerStatus(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := hds.Client.Set(":TRIGger:SINGle:SWEep SINGle"); err != nil {
+		return fmt.Errorf("failed to arm trigger: %w", err)
+	}
+	return nil
+}
+
+// WaitTrigger polls the trigger status until the scope armed by Arm triggered, returns
+// ErrTriggerTimeout when timeout elapsed first, or the context error when ctx is done first.
+func (hds *HDS) WaitTrigger(ctx context.Context, timeout time.Duration) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(triggerPollInterval)
+	defer ticker.Stop()
+	for {
+		status, err := hds.triggerStatus()
+		if err != nil {
+			return err
+		}
+		if triggered(status) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline.C:
+			return ErrTriggerTimeout
+		case <-ticker.C:
+		}
+	}
+}
+
+// Capture arms a single shot acquisition, waits for the trigger and fetches the frame.
+func (hds *HDS) Capture(ctx context.Context, timeout time.Duration) (frame *Frame, err error) {
+	if err := hds.Arm(); err != nil {
+		return nil, err
+	}
+	if err := hds.WaitTrigger(ctx, timeout); err != nil {
+		return nil, err
+	}
+	return hds.Acquire()
+}
+
+func (hds *HDS) triggerStatus() (string, error) {
+	status, err := hds.Client.GetString(":TRIGger:STATus?")
+	if err != nil {
+		return "", fmt.Errorf("failed to get trigger status: %w", err)
+	}
+	return status, nil
+}
+
+// in single sweep mode the scope reports TRIG once triggered, then STOP
+func triggered(status string) bool {
+	switch strings.ToUpper(strings.TrimSpace(status)) {
+	case "TRIG", "STOP":
+		return true
+	}
+	return false
+}
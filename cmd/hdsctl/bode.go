@@ -0,0 +1,79 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/frnckdlprt/hdsctl"
+	"github.com/frnckdlprt/hdsctl/fra"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// bode measures the frequency response of a circuit driven by the generator, with CH1 on its input
+// and CH2 on its output
+func bode(hds *hdsctl.HDS, args []string) error {
+	fs := flag.NewFlagSet("bode", flag.ExitOnError)
+	start := fs.Float64("start", 10, "first frequency in hertz")
+	stop := fs.Float64("stop", 100000, "last frequency in hertz")
+	steps := fs.Int("steps", 31, "number of log spaced frequencies, start and stop included")
+	ampl := fs.Float64("ampl", 0, "generator amplitude in volts peak to peak, unchanged when 0")
+	dwell := fs.Duration("dwell", 200*time.Millisecond, "settling time after each frequency change")
+	periods := fs.Float64("periods", 3, "minimum number of periods on screen")
+	format := fs.String("format", "csv", "output format: csv or json")
+	output := fs.String("o", "", "output file, stdout when empty")
+	fs.Parse(args)
+	if *format != "csv" && *format != "json" {
+		return fmt.Errorf("unsupported format: %s", *format)
+	}
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", *output, err)
+		}
+		defer f.Close()
+		w = f
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	opts := fra.Options{Start: *start, Stop: *stop, Steps: *steps, Amplitude: *ampl, Dwell: *dwell, Periods: *periods}
+	points, err := fra.Run(ctx, hds, opts, func(p *fra.Point) error {
+		log.Printf("%.6g Hz: %.2f dB %.1f° %s\n", p.Frequency, p.Gain, p.Phase, p.Warning)
+		return nil
+	})
+	// the points measured before an interruption are still written
+	if len(points) > 0 {
+		var werr error
+		if *format == "json" {
+			werr = json.NewEncoder(w).Encode(points)
+		} else {
+			werr = fra.WriteCSV(w, points)
+		}
+		if werr != nil {
+			return werr
+		}
+	}
+	return err
+}
@@ -0,0 +1,41 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"github.com/frnckdlprt/hdsctl"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// capture arms a single shot, waits for the trigger and prints the frame as json
+func capture(hds *hdsctl.HDS, args []string) error {
+	fs := flag.NewFlagSet("capture", flag.ExitOnError)
+	timeout := fs.Duration("timeout", 10*time.Second, "maximum time to wait for the trigger")
+	fs.Parse(args)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	frame, err := hds.Capture(ctx, *timeout)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(os.Stdout).Encode(frame)
+}
@@ -0,0 +1,200 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/frnckdlprt/hdsctl"
+	"github.com/frnckdlprt/hdsctl/decode"
+	"github.com/frnckdlprt/hdsctl/waveform"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+var decoders = map[string]func(frame *hdsctl.Frame, fs *flag.FlagSet) func() ([]decode.Event, error){
+	"dht":     decodeDHT,
+	"i2c":     decodeI2C,
+	"onewire": decodeSingleWire(decode.OneWire),
+	"spi":     decodeSPI,
+	"uart":    decodeUART,
+	"ws2812":  decodeSingleWire(decode.WS2812),
+}
+
+// decodeFrames decodes a protocol on successive live frames, or on the frames of a file
+func decodeFrames(hds *hdsctl.HDS, args []string) error {
+	protocols := []string{}
+	for p := range decoders {
+		protocols = append(protocols, p)
+	}
+	sort.Strings(protocols)
+	if len(args) == 0 || decoders[args[0]] == nil {
+		return fmt.Errorf("usage: hdsctl decode <%s> [flags]", strings.Join(protocols, "|"))
+	}
+	fs := flag.NewFlagSet("decode "+args[0], flag.ExitOnError)
+	input := fs.String("i", "", "segment or .hds file, every frame of it is decoded")
+	frames := fs.Int("frames", 1, "number of successive live frames to decode")
+	asJSON := fs.Bool("json", false, "print the events as json")
+	frame := &hdsctl.Frame{}
+	run := decoders[args[0]](frame, fs)
+	fs.Parse(args[1:])
+	series := *input != "" || *frames > 1
+	decodeFrame := func(f *hdsctl.Frame) error {
+		*frame = *f
+		events, err := run()
+		if err != nil {
+			return fmt.Errorf("failed to decode frame %v: %w", f.Seq, err)
+		}
+		if *asJSON {
+			return json.NewEncoder(os.Stdout).Encode(map[string]interface{}{"seq": f.Seq, "timestamp": f.Timestamp, "events": events})
+		}
+		// event times are relative to the trigger of their frame
+		if series {
+			fmt.Printf("# frame %v %s\n", f.Seq, f.Timestamp.Format(time.RFC3339Nano))
+		}
+		for _, e := range events {
+			fmt.Println(e)
+		}
+		return nil
+	}
+	if *input != "" {
+		list, err := loadFrames(hds, *input)
+		if err != nil {
+			return err
+		}
+		for _, f := range list {
+			if err := decodeFrame(f); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for i := 0; i < *frames; i++ {
+		f, err := hds.Acquire()
+		if err != nil {
+			return err
+		}
+		if err := decodeFrame(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeUART(frame *hdsctl.Frame, fs *flag.FlagSet) func() ([]decode.Event, error) {
+	ch := fs.Int("ch", 1, "channel")
+	baud := fs.Float64("baud", 0, "baud rate, detected when 0")
+	bits := fs.Int("bits", 8, "data bits, detected along with the parity when 0")
+	parity := fs.String("parity", "none", "parity: none, even, odd")
+	stop := fs.Float64("stop", 1, "stop bits, detected when 0")
+	inverted := fs.Bool("inverted", false, "inverted line, idle low")
+	return func() ([]decode.Event, error) {
+		w, err := frame.Waveform(*ch)
+		if err != nil {
+			return nil, err
+		}
+		cfg := decode.UARTConfig{Baud: *baud, DataBits: *bits, StopBits: *stop, Inverted: *inverted}
+		cfg.Parity, err = decode.ParseParity(*parity)
+		if err != nil {
+			return nil, err
+		}
+		events, cfg, err := decode.UART(w, cfg)
+		if err == nil && (*baud == 0 || *bits == 0 || *stop == 0) {
+			log.Printf("detected %v bauds %s\n", cfg.Baud, cfg.Format())
+		}
+		return events, err
+	}
+}
+
+func decodeI2C(frame *hdsctl.Frame, fs *flag.FlagSet) func() ([]decode.Event, error) {
+	scl := fs.Int("scl", 1, "SCL channel")
+	sda := fs.Int("sda", 2, "SDA channel")
+	mode := fs.String("mode", "standard", "timings to check: standard, fast or none")
+	return func() ([]decode.Event, error) {
+		cfg, err := decode.ParseI2CMode(*mode)
+		if err != nil {
+			return nil, err
+		}
+		wscl, err := frame.Waveform(*scl)
+		if err != nil {
+			return nil, err
+		}
+		wsda, err := frame.Waveform(*sda)
+		if err != nil {
+			return nil, err
+		}
+		return decode.I2C(wscl, wsda, cfg)
+	}
+}
+
+func decodeSPI(frame *hdsctl.Frame, fs *flag.FlagSet) func() ([]decode.Event, error) {
+	clk := fs.Int("clk", 1, "SCLK channel")
+	data := fs.Int("data", 2, "MOSI or MISO channel")
+	mode := fs.Int("mode", 0, "spi mode, 0 to 3, setting CPOL and CPHA")
+	lsb := fs.Bool("lsb", false, "least significant bit first")
+	bits := fs.Int("bits", 8, "word size")
+	gap := fs.Duration("gap", 0, "idle time ending a transfer, 4 clock periods when 0")
+	return func() ([]decode.Event, error) {
+		cfg := decode.SPIConfig{LSBFirst: *lsb, WordBits: *bits, IdleGap: gap.Seconds()}
+		if err := cfg.SetMode(*mode); err != nil {
+			return nil, err
+		}
+		wclk, err := frame.Waveform(*clk)
+		if err != nil {
+			return nil, err
+		}
+		wdata, err := frame.Waveform(*data)
+		if err != nil {
+			return nil, err
+		}
+		return decode.SPI(wclk, wdata, cfg)
+	}
+}
+
+// decodeSingleWire decodes a protocol of a single channel, such as 1-Wire or WS2812
+func decodeSingleWire(decoder func(w *waveform.Waveform, low, high float64) ([]decode.Event, error)) func(frame *hdsctl.Frame, fs *flag.FlagSet) func() ([]decode.Event, error) {
+	return func(frame *hdsctl.Frame, fs *flag.FlagSet) func() ([]decode.Event, error) {
+		ch := fs.Int("ch", 1, "channel")
+		return func() ([]decode.Event, error) {
+			w, err := frame.Waveform(*ch)
+			if err != nil {
+				return nil, err
+			}
+			return decoder(w, 0, 0)
+		}
+	}
+}
+
+func decodeDHT(frame *hdsctl.Frame, fs *flag.FlagSet) func() ([]decode.Event, error) {
+	ch := fs.Int("ch", 1, "channel")
+	model := fs.String("model", "dht22", "sensor model: dht11, dht22")
+	return func() ([]decode.Event, error) {
+		m, err := decode.ParseDHTModel(*model)
+		if err != nil {
+			return nil, err
+		}
+		w, err := frame.Waveform(*ch)
+		if err != nil {
+			return nil, err
+		}
+		return decode.DHT(w, m, 0, 0)
+	}
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/frnckdlprt/hdsctl"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// multimeter configures the multimeter and prints its readings, then their statistics
+func multimeter(hds *hdsctl.HDS, args []string) error {
+	fs := flag.NewFlagSet("dmm", flag.ExitOnError)
+	mode := fs.String("mode", "", "measurement function: DCV, ACV, DCA, ACA, R, CONT, DIODE or C, unchanged when empty")
+	rng := fs.String("range", "", "range of the voltage modes: auto, mV or V, unchanged when empty")
+	rel := fs.String("rel", "", "relative mode: on or off, unchanged when empty")
+	count := fs.Int("count", 1, "number of readings, 0 for no limit")
+	interval := fs.Duration("interval", 500*time.Millisecond, "time between two readings")
+	fs.Parse(args)
+	dmm := hdsctl.NewDMM(hds)
+	if *mode != "" {
+		m, err := hdsctl.ParseDMMMode(*mode)
+		if err != nil {
+			return err
+		}
+		if err := dmm.SetMode(m); err != nil {
+			return err
+		}
+	}
+	switch *rng {
+	case "":
+	case "auto":
+		if err := dmm.Auto(); err != nil {
+			return err
+		}
+	default:
+		if err := dmm.SetRange(*rng); err != nil {
+			return err
+		}
+	}
+	switch *rel {
+	case "":
+	case "on", "off":
+		if err := dmm.SetRelative(*rel == "on"); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid relative mode: %s", *rel)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for i := 0; *count == 0 || i < *count; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				fmt.Println(dmm.Stats())
+				return nil
+			case <-ticker.C:
+			}
+		}
+		r, err := dmm.Read()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s %s\n", r.Time.Format(time.RFC3339Nano), r)
+	}
+	if *count > 1 {
+		fmt.Println(dmm.Stats())
+	}
+	return nil
+}
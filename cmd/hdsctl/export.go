@@ -0,0 +1,253 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/frnckdlprt/hdsctl"
+	"github.com/frnckdlprt/hdsctl/archive"
+	"github.com/frnckdlprt/hdsctl/export"
+	"github.com/frnckdlprt/hdsctl/mathchan"
+	"github.com/frnckdlprt/hdsctl/waveform"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// exportFrames writes a live frame, or frames from a segment file, in the given format
+func exportFrames(hds *hdsctl.HDS, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "csv", "output format: csv, tsv, npz, sr, wav, hds")
+	input := fs.String("i", "", "segment or .hds file to export, a live frame is acquired when empty")
+	output := fs.String("o", "", "output file, stdout when empty")
+	digital := fs.String("digital", "", "sr digital channels made by thresholding analog ones, such as D0=CH1:1.65,D1=CH2:1.65")
+	normalize := fs.Bool("normalize", false, "wav samples normalized to the peak value as 16 bits PCM instead of volts as 32 bits floats")
+	note := fs.String("note", "", "hds annotation")
+	math := fs.String("math", "", "math channel expression exported after the channels, such as CH1-CH2, not supported for hds")
+	seq := fs.Uint64("seq", 0, "sequence number of the frame to export from the segment file, the first one (or all of them for series formats) when 0")
+	acquire := fs.String("acquire", "sample", "acquire mode: sample, average or envelope of the frames of the file, or of successive live frames")
+	count := fs.Int("frames", 16, "number of live frames to average or to envelope")
+	fs.Parse(args)
+	switch *format {
+	case "csv", "tsv", "npz", "sr", "wav", "hds":
+	default:
+		return fmt.Errorf("unsupported format: %s", *format)
+	}
+	mode, err := hdsctl.ParseAcquireMode(*acquire)
+	if err != nil {
+		return err
+	}
+	if mode != hdsctl.AcquireSample && *seq != 0 {
+		return fmt.Errorf("-seq cannot be used with the %s acquire mode, which combines all the frames", *acquire)
+	}
+	if mode == hdsctl.AcquireEnvelope && (*format == "sr" || *format == "wav") {
+		return fmt.Errorf("the envelope cannot be exported as %s", *format)
+	}
+	if *math != "" && *format == "hds" {
+		return fmt.Errorf("the math channel cannot be exported as hds")
+	}
+	dcs, err := parseDigitalChannels(*digital)
+	if err != nil {
+		return err
+	}
+	var extra export.Extra
+	if *math != "" {
+		e, err := mathchan.Parse(*math)
+		if err != nil {
+			return err
+		}
+		extra = func(frame *hdsctl.Frame) ([]*waveform.Waveform, error) {
+			m, err := e.EvalFrame("MATH", frame)
+			if err != nil {
+				return nil, err
+			}
+			return []*waveform.Waveform{m}, nil
+		}
+	}
+	frames, err := loadFrames(hds, *input)
+	if err != nil {
+		return err
+	}
+	for i := 1; *input == "" && mode != hdsctl.AcquireSample && i < *count; i++ {
+		frame, err := hds.Acquire()
+		if err != nil {
+			return err
+		}
+		frames = append(frames, frame)
+	}
+	// the average is exported in volts without rounding; the envelope is exported as min and max frames,
+	// or as min and max columns along the last frame for csv/tsv
+	var acc *hdsctl.Accumulator
+	if mode != hdsctl.AcquireSample {
+		acc = &hdsctl.Accumulator{Mode: mode}
+		for _, frame := range frames {
+			acc.Add(frame)
+		}
+		last := frames[len(frames)-1]
+		frames, err = acc.Frames()
+		if err != nil {
+			return err
+		}
+		if mode == hdsctl.AcquireEnvelope && (*format == "csv" || *format == "tsv") {
+			frames = []*hdsctl.Frame{last}
+		}
+	}
+	if *seq != 0 {
+		frame, err := selectFrame(frames, *seq)
+		if err != nil {
+			return err
+		}
+		frames = []*hdsctl.Frame{frame}
+	}
+	// the output is only created once the frames to export are known
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", *output, err)
+		}
+		defer f.Close()
+		w = f
+	}
+	switch *format {
+	case "csv", "tsv":
+		frame := frames[0]
+		comma := ','
+		if *format == "tsv" {
+			comma = '\t'
+		}
+		columns := []*waveform.Waveform{}
+		if extra != nil {
+			if columns, err = extra(frame); err != nil {
+				return err
+			}
+		}
+		if acc != nil && mode == hdsctl.AcquireEnvelope {
+			for _, ch := range frame.Channels() {
+				ws, err := acc.Waveforms(ch)
+				if err != nil {
+					return err
+				}
+				columns = append(columns, ws...)
+			}
+		}
+		return export.WriteCSV(w, frame, comma, columns...)
+	case "npz":
+		if (*input != "" || mode == hdsctl.AcquireEnvelope) && *seq == 0 {
+			return export.WriteNPZSeries(w, frames, extra)
+		}
+		return export.WriteNPZ(w, frames[0], extra)
+	case "sr":
+		return export.WriteSigrok(w, frames[0], dcs, extra)
+	case "wav":
+		return export.WriteWAV(w, frames, *normalize, extra)
+	case "hds":
+		// the field values are only known for a live capture
+		c := archive.New(frames)
+		if *input == "" {
+			c = archive.FromHDS(hds, frames)
+		}
+		if *note != "" {
+			c.Annotate(archive.Annotation{Text: *note})
+		}
+		return archive.Write(w, c)
+	}
+	return fmt.Errorf("unsupported format: %s", *format)
+}
+
+// loadFrames reads the frames of a segment or .hds file, or acquires a live frame when input is empty
+func loadFrames(hds *hdsctl.HDS, input string) (frames []*hdsctl.Frame, err error) {
+	if input == "" {
+		frame, err := hds.Acquire()
+		if err != nil {
+			return nil, err
+		}
+		return []*hdsctl.Frame{frame}, nil
+	}
+	if strings.ToLower(filepath.Ext(input)) == ".hds" {
+		c, err := archive.ReadFile(input)
+		if err != nil {
+			return nil, err
+		}
+		if len(c.Frames) == 0 {
+			return nil, fmt.Errorf("no frame in %s", input)
+		}
+		return c.Frames, nil
+	}
+	f, err := os.Open(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", input, err)
+	}
+	defer f.Close()
+	err = hdsctl.ReadSegments(f, func(frame *hdsctl.Frame) error {
+		frames = append(frames, frame)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("no frame in %s", input)
+	}
+	return frames, nil
+}
+
+func selectFrame(frames []*hdsctl.Frame, seq uint64) (*hdsctl.Frame, error) {
+	if seq == 0 {
+		return frames[0], nil
+	}
+	for _, frame := range frames {
+		if frame.Seq == seq {
+			return frame, nil
+		}
+	}
+	return nil, fmt.Errorf("no frame with sequence number %v", seq)
+}
+
+// parseDigitalChannels parses digital channel definitions such as D0=CH1:1.65,D1=CH2:1.65
+func parseDigitalChannels(s string) (result []export.DigitalChannel, err error) {
+	if s == "" {
+		return nil, nil
+	}
+	for _, def := range strings.Split(s, ",") {
+		dc := export.DigitalChannel{}
+		var src string
+		name, rest, ok := strings.Cut(def, "=")
+		if ok {
+			src, rest, ok = strings.Cut(rest, ":")
+		}
+		if ok {
+			dc.Name = name
+			_, err = fmt.Sscanf(strings.ToUpper(src)+" "+rest, "CH%d %g", &dc.Channel, &dc.Threshold)
+		}
+		if !ok || err != nil {
+			return nil, fmt.Errorf("invalid digital channel: %s", def)
+		}
+		result = append(result, dc)
+	}
+	return result, nil
+}
+
+func evalMath(expr string, frame *hdsctl.Frame) (*waveform.Waveform, error) {
+	e, err := mathchan.Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	return e.EvalFrame("MATH", frame)
+}
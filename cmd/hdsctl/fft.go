@@ -0,0 +1,86 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/frnckdlprt/hdsctl"
+	"github.com/frnckdlprt/hdsctl/fft"
+	"github.com/frnckdlprt/hdsctl/waveform"
+	"strings"
+)
+
+// spectrum prints the magnitude spectrum of a channel, averaged over successive frames
+func spectrum(hds *hdsctl.HDS, args []string) error {
+	fs := flag.NewFlagSet("fft", flag.ExitOnError)
+	ch := fs.Int("ch", 1, "channel")
+	math := fs.String("math", "", "math channel expression to analyse instead of the channel, such as CH1-CH2")
+	window := fs.String("window", "hann", "window: "+strings.Join(fft.WindowNames(), ", "))
+	frames := fs.Int("frames", 1, "number of live frames to average")
+	input := fs.String("i", "", "segment or .hds file, every frame of it is averaged")
+	unit := fs.String("unit", "dbv", "magnitude unit: dbv, v")
+	peaks := fs.Int("peaks", 5, "number of peaks to report")
+	fs.Parse(args)
+	win, err := fft.ParseWindow(*window)
+	if err != nil {
+		return err
+	}
+	var list []*hdsctl.Frame
+	if *input != "" {
+		list, err = loadFrames(hds, *input)
+		if err != nil {
+			return err
+		}
+	}
+	for i := 0; *input == "" && i < *frames; i++ {
+		frame, err := hds.Acquire()
+		if err != nil {
+			return err
+		}
+		list = append(list, frame)
+	}
+	avg := &fft.Averager{}
+	for _, frame := range list {
+		var w *waveform.Waveform
+		if *math != "" {
+			w, err = evalMath(*math, frame)
+		} else {
+			w, err = frame.Waveform(*ch)
+		}
+		if err != nil {
+			return err
+		}
+		s, err := fft.Compute(w, win)
+		if err != nil {
+			return err
+		}
+		avg.Add(s)
+	}
+	s := avg.Spectrum()
+	if *unit == "dbv" {
+		s = s.DB()
+	}
+	for _, p := range fft.Peaks(s, *peaks) {
+		fmt.Printf("# peak: %g Hz %g %s\n", p.Frequency, p.Magnitude, s.Unit)
+	}
+	fmt.Printf("frequency_Hz\t%s\n", s.Unit)
+	for i, m := range s.Magnitudes {
+		fmt.Printf("%g\t%g\n", s.Frequency(i), m)
+	}
+	return nil
+}
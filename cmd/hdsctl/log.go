@@ -0,0 +1,66 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"github.com/frnckdlprt/hdsctl"
+	"github.com/frnckdlprt/hdsctl/datalog"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// datalogger appends timestamped rows of field values to a csv or ndjson file, until interrupted
+func datalogger(hds *hdsctl.HDS, args []string) error {
+	fs := flag.NewFlagSet("log", flag.ExitOnError)
+	fields := fs.String("f", ":MEASurement:CH1:PKPK", "comma separated field ids or scpi queries, such as :MEASurement:CH1:FREQuency,:DMM:MEAS")
+	output := fs.String("o", "log.csv", "csv file, or ndjson file when the extension is .ndjson or .jsonl")
+	interval := fs.Duration("interval", time.Second, "time between two rows")
+	count := fs.Int("count", 0, "maximum number of rows, 0 for no limit")
+	duration := fs.Duration("duration", 0, "maximum logging time, 0 for no limit")
+	rotateSize := fs.Int64("rotate-size", 0, "size in bytes after which a new file is started, 0 for no limit")
+	rotateAge := fs.Duration("rotate-age", 0, "age after which a new file is started, such as 24h, 0 for no limit")
+	maxFailures := fs.Int("max-failures", 0, "consecutive rows without any value before giving up, 0 for no limit")
+	fs.Parse(args)
+	opts := datalog.Options{Fields: strings.Split(*fields, ","), Interval: *interval, Count: *count, Duration: *duration, MaxFailures: *maxFailures}
+	fw := datalog.NewFileWriter(*output, opts.Fields)
+	fw.MaxSize, fw.MaxAge = *rotateSize, *rotateAge
+	defer fw.Close()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	name := ""
+	n, err := datalog.Run(ctx, hds, opts, func(row *datalog.Row) error {
+		if err := fw.Write(row); err != nil {
+			return err
+		}
+		if fw.Name() != name {
+			name = fw.Name()
+			log.Printf("logging to %s\n", name)
+		}
+		return nil
+	})
+	log.Printf("%v rows logged\n", n)
+	if err != nil {
+		return err
+	}
+	return fw.Close()
+}
@@ -17,15 +17,44 @@ limitations under the License.
 package main
 
 import (
+	"errors"
 	"fmt"
 	"github.com/frnckdlprt/hdsctl"
+	"github.com/frnckdlprt/hdsctl/mask"
 	"github.com/frnckdlprt/hdsctl/scpi"
 	"github.com/frnckdlprt/hdsctl/version"
 	"github.com/frnckdlprt/hdsctl/web"
+	"log"
 	"os"
 	"strings"
 )
 
+var commands = map[string]func(hds *hdsctl.HDS, args []string) error{
+	"bode":     bode,
+	"capture":  capture,
+	"decode":   decodeFrames,
+	"dmm":      multimeter,
+	"export":   exportFrames,
+	"fft":      spectrum,
+	"log":      datalogger,
+	"masktest": masktest,
+	"measure":  measurements,
+	"persist":  persist,
+	"record":   record,
+	"stepresp": stepResponse,
+	"sweep":    sweeper,
+}
+
+func exitCode(err error) int {
+	if errors.Is(err, hdsctl.ErrTriggerTimeout) {
+		return 2
+	}
+	if errors.Is(err, mask.ErrFailed) {
+		return 3
+	}
+	return 1
+}
+
 //
 ///*
 //#cgo pkg-config: libusb-1.0
@@ -60,17 +89,32 @@ import (
 //}
 
 func main() {
-	executor := scpi.NewHDSExecutor()
-	defer executor.Close()
-	//executor := scpi.NewMockExecutor()
-	hds := hdsctl.NewHDS(scpi.NewHDSClient(executor))
 	if os.Args[1] == "version" {
 		fmt.Printf("hdsctl version %s (%s)\n", version.Version, version.BuildDate)
 		return
 	}
+	// view does not need a scope attached
+	if os.Args[1] == "view" {
+		if err := view(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	executor := scpi.NewHDSExecutor()
+	defer executor.Close()
+	//executor := scpi.NewMockExecutor()
+	hds := hdsctl.NewHDS(scpi.NewHDSClient(executor))
 	if os.Args[1] == "serve" {
 		web.StartServer(hds)
 		return
 	}
+	if cmd, ok := commands[os.Args[1]]; ok {
+		if err := cmd(hds, os.Args[2:]); err != nil {
+			log.Println(err)
+			executor.Close()
+			os.Exit(exitCode(err))
+		}
+		return
+	}
 	hds.Client.Execute(strings.Join(os.Args[1:], " "))
 }
@@ -0,0 +1,122 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/frnckdlprt/hdsctl"
+	"github.com/frnckdlprt/hdsctl/mask"
+	"os"
+	"time"
+)
+
+// masktest tests successive live frames, or the frames of a file, against a mask, and fails when any frame fails
+func masktest(hds *hdsctl.HDS, args []string) error {
+	fs := flag.NewFlagSet("masktest", flag.ExitOnError)
+	maskFile := fs.String("mask", "", "json mask file of polygons and bands")
+	ref := fs.String("ref", "", "segment or .hds file whose first frame is the reference of a tolerance band")
+	ch := fs.Int("ch", 1, "channel of the tolerance band")
+	volts := fs.Float64("dv", 0.1, "vertical tolerance of the band in volts")
+	dt := fs.Duration("dt", 0, "horizontal tolerance of the band")
+	save := fs.String("save", "", "json file to save the mask to")
+	input := fs.String("i", "", "segment or .hds file to test, live frames are tested when empty")
+	count := fs.Int("count", 10, "number of live frames to test")
+	interval := fs.Duration("interval", 0, "minimum time between two live frames")
+	fails := fs.String("fails", "", "segment file to save the failing frames to")
+	fs.Parse(args)
+	m := &mask.Mask{}
+	if *maskFile != "" {
+		var err error
+		m, err = mask.ReadFile(*maskFile)
+		if err != nil {
+			return err
+		}
+	}
+	if *ref != "" {
+		frames, err := loadFrames(hds, *ref)
+		if err != nil {
+			return err
+		}
+		w, err := frames[0].Waveform(*ch)
+		if err != nil {
+			return err
+		}
+		m.Bands = append(m.Bands, mask.NewBand(*ch, w, *volts, dt.Seconds()))
+	}
+	if len(m.Polygons) == 0 && len(m.Bands) == 0 {
+		return fmt.Errorf("no mask, use -mask or -ref")
+	}
+	if *save != "" {
+		if err := mask.WriteFile(*save, m); err != nil {
+			return err
+		}
+	}
+	var sw *hdsctl.SegmentWriter
+	if *fails != "" {
+		f, err := os.OpenFile(*fails, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", *fails, err)
+		}
+		defer f.Close()
+		sw = hdsctl.NewSegmentWriter(f)
+	}
+	stats := mask.Stats{}
+	test := func(frame *hdsctl.Frame) error {
+		r, err := m.Test(frame)
+		if err != nil {
+			return err
+		}
+		stats.Add(r)
+		if r.Pass {
+			fmt.Printf("frame %v PASS\n", frame.Seq)
+			return nil
+		}
+		fmt.Printf("frame %v FAIL %v samples, first: %v\n", frame.Seq, r.Count, r.Violations[0])
+		if sw != nil {
+			return sw.Write(frame)
+		}
+		return nil
+	}
+	if *input != "" {
+		frames, err := loadFrames(hds, *input)
+		if err != nil {
+			return err
+		}
+		for _, frame := range frames {
+			if err := test(frame); err != nil {
+				return err
+			}
+		}
+	}
+	for i := 0; *input == "" && i < *count; i++ {
+		start := time.Now()
+		frame, err := hds.Acquire()
+		if err != nil {
+			return err
+		}
+		if err := test(frame); err != nil {
+			return err
+		}
+		time.Sleep(*interval - time.Since(start))
+	}
+	fmt.Println(stats)
+	if stats.Failed > 0 {
+		return fmt.Errorf("%v frames out of %v: %w", stats.Failed, stats.Tested, mask.ErrFailed)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/frnckdlprt/hdsctl"
+	"github.com/frnckdlprt/hdsctl/measure"
+	"github.com/frnckdlprt/hdsctl/waveform"
+)
+
+// measurements prints the host side measurements of a channel or math channel
+func measurements(hds *hdsctl.HDS, args []string) error {
+	fs := flag.NewFlagSet("measure", flag.ExitOnError)
+	ch := fs.Int("ch", 1, "channel")
+	math := fs.String("math", "", "math channel expression to measure instead of the channel, such as CH1*CH2")
+	input := fs.String("i", "", "segment or .hds file, a live frame is acquired when empty")
+	seq := fs.Uint64("seq", 0, "sequence number of the frame to measure from the file, the first one when 0")
+	fs.Parse(args)
+	frames, err := loadFrames(hds, *input)
+	if err != nil {
+		return err
+	}
+	frame, err := selectFrame(frames, *seq)
+	if err != nil {
+		return err
+	}
+	var w *waveform.Waveform
+	if *math != "" {
+		w, err = evalMath(*math, frame)
+	} else {
+		w, err = frame.Waveform(*ch)
+	}
+	if err != nil {
+		return err
+	}
+	for _, m := range measure.Measurements(w, measure.DefaultOptions()) {
+		if m.Valid {
+			fmt.Printf("%s\t%g\t%s\n", m.Name, m.Value, m.Unit)
+		} else {
+			fmt.Printf("%s\t-\t%s\n", m.Name, m.Unit)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/frnckdlprt/hdsctl"
+	"github.com/frnckdlprt/hdsctl/persistence"
+	"image/png"
+	"io"
+	"os"
+)
+
+// persist renders the persistence of successive live frames, or of the frames of a file, as a heatmap
+func persist(hds *hdsctl.HDS, args []string) error {
+	fs := flag.NewFlagSet("persist", flag.ExitOnError)
+	input := fs.String("i", "", "segment or .hds file, every frame of it is accumulated")
+	frames := fs.Int("frames", 100, "number of live frames to accumulate")
+	decay := fs.Duration("decay", 0, "decay time constant, infinite persistence when 0")
+	width := fs.Int("width", 600, "number of time columns")
+	height := fs.Int("height", 400, "number of voltage rows")
+	binary := fs.Bool("bin", false, "write the binary stream of the intensities instead of a png image")
+	output := fs.String("o", "", "output file, stdout when empty")
+	fs.Parse(args)
+	p := persistence.New(*width, *height, *decay)
+	if *input != "" {
+		list, err := loadFrames(hds, *input)
+		if err != nil {
+			return err
+		}
+		for _, frame := range list {
+			p.Add(frame)
+		}
+	}
+	for i := 0; *input == "" && i < *frames; i++ {
+		frame, err := hds.Acquire()
+		if err != nil {
+			return err
+		}
+		p.Add(frame)
+	}
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", *output, err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if *binary {
+		return p.WriteBinary(w)
+	}
+	if err := png.Encode(w, p.Image()); err != nil {
+		return fmt.Errorf("failed to write image: %w", err)
+	}
+	return nil
+}
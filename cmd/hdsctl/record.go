@@ -0,0 +1,54 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/frnckdlprt/hdsctl"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// record repeatedly captures single shot frames into a segment file
+func record(hds *hdsctl.HDS, args []string) error {
+	fs := flag.NewFlagSet("record", flag.ExitOnError)
+	output := fs.String("o", "segments.ndjson", "segment file")
+	count := fs.Int("count", 0, "maximum number of frames, 0 for no limit")
+	duration := fs.Duration("duration", 0, "maximum recording time, 0 for no limit")
+	interval := fs.Duration("interval", 0, "minimum time between two captures")
+	timeout := fs.Duration("timeout", 10*time.Second, "time to wait for a trigger before re-arming")
+	fs.Parse(args)
+	f, err := os.OpenFile(*output, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", *output, err)
+	}
+	defer f.Close()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	sw := hdsctl.NewSegmentWriter(f)
+	opts := hdsctl.RecordOptions{Count: *count, Duration: *duration, Interval: *interval, Timeout: *timeout}
+	n, err := hds.Record(ctx, opts, func(frame *hdsctl.Frame) error {
+		log.Printf("frame %v triggered at %v\n", frame.Seq, frame.Timestamp.Format(time.RFC3339Nano))
+		return sw.Write(frame)
+	})
+	log.Printf("%v frames recorded to %s\n", n, *output)
+	return err
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/frnckdlprt/hdsctl"
+	"github.com/frnckdlprt/hdsctl/stepresp"
+	"os"
+	"time"
+)
+
+// stepResponse drives a square wave from the generator and measures the response on a channel to
+// the edges of a reference channel, averaged over the edges of successive frames
+func stepResponse(hds *hdsctl.HDS, args []string) error {
+	fs := flag.NewFlagSet("stepresp", flag.ExitOnError)
+	ref := fs.Int("ref", 1, "reference channel, on the circuit input")
+	resp := fs.Int("ch", 2, "response channel, on the circuit output")
+	freq := fs.Float64("freq", 1000, "square wave frequency in hertz, the generator is left as is when 0")
+	high := fs.Float64("high", 1, "square wave high level in volts")
+	low := fs.Float64("low", 0, "square wave low level in volts")
+	periods := fs.Float64("periods", 2, "number of periods on screen, the time base is left as is when 0")
+	dwell := fs.Duration("dwell", 500*time.Millisecond, "settling time after configuring the generator")
+	tol := fs.Float64("tol", 2, "settling band in percent of the step")
+	gain := fs.Float64("gain", 1, "expected gain from the reference to the response")
+	frames := fs.Int("frames", 8, "number of successive live frames")
+	input := fs.String("i", "", "segment or .hds file whose frames are analysed, instead of live frames")
+	asJSON := fs.Bool("json", false, "print the edges and their averages as json")
+	fs.Parse(args)
+	if *input == "" && *freq > 0 {
+		gen := hdsctl.NewGenerator(hds)
+		if err := gen.SetWaveform(hdsctl.Square); err != nil {
+			return err
+		}
+		if err := gen.SetFrequency(*freq); err != nil {
+			return err
+		}
+		if err := gen.SetLevels(*high, *low); err != nil {
+			return err
+		}
+		if err := gen.Output(true); err != nil {
+			return err
+		}
+		if *periods > 0 {
+			if err := hds.FitTimeBase(*freq, *periods); err != nil {
+				return err
+			}
+		}
+		for _, ch := range []int{*ref, *resp} {
+			if err := hds.Client.Set(fmt.Sprintf(":CH%d:DISPlay ON", ch)); err != nil {
+				return fmt.Errorf("failed to display CH%d: %w", ch, err)
+			}
+		}
+		time.Sleep(*dwell)
+	}
+	list, err := loadFrames(hds, *input)
+	if err != nil {
+		return err
+	}
+	for i := 1; *input == "" && i < *frames; i++ {
+		frame, err := hds.Acquire()
+		if err != nil {
+			return err
+		}
+		list = append(list, frame)
+	}
+	opts := stepresp.DefaultOptions()
+	opts.Tolerance, opts.Gain = *tol/100, *gain
+	edges := []stepresp.Edge{}
+	for _, frame := range list {
+		wref, err := frame.Waveform(*ref)
+		if err != nil {
+			return err
+		}
+		wresp, err := frame.Waveform(*resp)
+		if err != nil {
+			return err
+		}
+		e, err := stepresp.Analyze(wref, wresp, opts)
+		if err != nil {
+			return fmt.Errorf("failed to analyse frame %v: %w", frame.Seq, err)
+		}
+		edges = append(edges, e...)
+	}
+	if len(edges) == 0 {
+		return fmt.Errorf("no complete edge in %v frames, the time base should show at least two edges of the reference", len(list))
+	}
+	summary := stepresp.Summarize(edges)
+	if *asJSON {
+		return json.NewEncoder(os.Stdout).Encode(map[string]interface{}{"edges": edges, "summary": summary})
+	}
+	for _, m := range summary {
+		if m.Valid {
+			fmt.Printf("%s\t%g\t%s\n", m.Name, m.Value, m.Unit)
+		} else {
+			fmt.Printf("%s\t-\t%s\n", m.Name, m.Unit)
+		}
+	}
+	return nil
+}
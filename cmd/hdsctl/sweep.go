@@ -0,0 +1,104 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"github.com/frnckdlprt/hdsctl"
+	"github.com/frnckdlprt/hdsctl/sweep"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// sweeper steps the generator frequency or amplitude, and writes the measurements of each step as csv rows
+func sweeper(hds *hdsctl.HDS, args []string) error {
+	fs := flag.NewFlagSet("sweep", flag.ExitOnError)
+	param := fs.String("param", "frequency", "generator setting to step: frequency or amplitude")
+	start := fs.Float64("start", 100, "first value, in hertz or volts peak to peak")
+	stop := fs.Float64("stop", 10000, "last value, in hertz or volts peak to peak")
+	steps := fs.Int("steps", 10, "number of values, start and stop included")
+	logScale := fs.Bool("log", false, "logarithmic spacing of the values")
+	dwell := fs.Duration("dwell", 500*time.Millisecond, "settling time after each step")
+	fields := fs.String("f", "", "comma separated field ids or scpi queries measured at each step, such as :MEASurement:CH1:PKPK")
+	output := fs.String("o", "", "csv file, stdout when empty")
+	frames := fs.String("frames", "", "segment file receiving the frame acquired at each step, none when empty")
+	fs.Parse(args)
+	p, err := sweep.ParseParameter(*param)
+	if err != nil {
+		return err
+	}
+	opts := sweep.Options{Parameter: p, Start: *start, Stop: *stop, Steps: *steps, Log: *logScale, Dwell: *dwell, Capture: *frames != ""}
+	if *fields != "" {
+		opts.Fields = strings.Split(*fields, ",")
+	}
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", *output, err)
+		}
+		defer f.Close()
+		w = f
+	}
+	var sw *hdsctl.SegmentWriter
+	if *frames != "" {
+		f, err := os.Create(*frames)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", *frames, err)
+		}
+		defer f.Close()
+		sw = hdsctl.NewSegmentWriter(f)
+	}
+	cw := csv.NewWriter(w)
+	defer cw.Flush()
+	if err := cw.Write(append([]string{"step", string(p), "time"}, opts.Fields...)); err != nil {
+		return fmt.Errorf("failed to write csv: %w", err)
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	n, err := sweep.Run(ctx, hds, opts, func(step *sweep.Step) error {
+		log.Printf("step %v/%v: %.6g\n", step.Index+1, step.Total, step.Value)
+		if len(step.Errors) > 0 {
+			log.Printf("failed to measure step %v: %v\n", step.Index+1, step.Errors)
+		}
+		row := []string{strconv.Itoa(step.Index), strconv.FormatFloat(step.Value, 'g', -1, 64), step.Time.Format(time.RFC3339Nano)}
+		for _, f := range opts.Fields {
+			row = append(row, step.Values[f])
+		}
+		if err := cw.Write(row); err != nil {
+			return fmt.Errorf("failed to write csv: %w", err)
+		}
+		cw.Flush()
+		if sw != nil {
+			return sw.Write(step.Frame)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("sweep stopped after %v steps: %w", n, err)
+	}
+	return cw.Error()
+}
@@ -0,0 +1,40 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"github.com/frnckdlprt/hdsctl"
+	"github.com/frnckdlprt/hdsctl/archive"
+	"github.com/frnckdlprt/hdsctl/scpi"
+	"github.com/frnckdlprt/hdsctl/web"
+	"log"
+)
+
+// view serves a saved .hds capture in the web interface
+func view(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: hdsctl view <file.hds>")
+	}
+	c, err := archive.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	log.Printf("serving %v frames of %s captured by %s\n", len(c.Frames), args[0], c.IDN)
+	web.StartServer(hdsctl.NewHDS(scpi.NewHDSClient(archive.NewReplayExecutor(c))))
+	return nil
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package datalog
+
+import (
+	"context"
+	"fmt"
+	"github.com/frnckdlprt/hdsctl"
+	"log"
+	"strings"
+	"time"
+)
+
+// delay before retrying a field whose query failed
+const retryDelay = 100 * time.Millisecond
+
+type Options struct {
+	// fields to sample: field ids, or scpi queries such as :MEASurement:CH1:PKPK or :DMM:MEAS
+	Fields []string
+	// time between two rows
+	Interval time.Duration
+	// maximum number of rows, 0 for no limit
+	Count int
+	// maximum logging time, 0 for no limit
+	Duration time.Duration
+	// number of consecutive rows without any value before giving up, 0 for no limit
+	MaxFailures int
+}
+
+// Row holds the values of the fields at a time, along with the errors of the fields that could not be read.
+type Row struct {
+	Time   time.Time         `json:"time"`
+	Values map[string]string `json:"values"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// Sample returns the value of a field id or of a scpi query, the query is retried once on error
+// or empty answer, which is how a usb transfer failure shows.
+func Sample(hds *hdsctl.HDS, field string) (v string, err error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		if attempt > 0 {
+			time.Sleep(retryDelay)
+		}
+		if strings.HasPrefix(field, ":") || strings.HasPrefix(field, "*") {
+			v, err = hds.Client.GetString(strings.TrimSuffix(field, "?") + "?")
+		} else {
+			v, err = hds.GetField(field)
+		}
+		if err == nil && v == "" {
+			err = fmt.Errorf("no answer for %s", field)
+		}
+		if err == nil {
+			return v, nil
+		}
+	}
+	return "", err
+}
+
+// Run samples the fields every interval and passes the rows to fn, until the count or duration is
+// reached or ctx is done. Field errors are reported in the rows, rather than stopping the logging.
+// It returns the number of rows.
+func Run(ctx context.Context, hds *hdsctl.HDS, opts Options, fn func(row *Row) error) (count int, err error) {
+	if len(opts.Fields) == 0 {
+		return 0, fmt.Errorf("no field to log")
+	}
+	if opts.Interval <= 0 {
+		return 0, fmt.Errorf("invalid interval: %v", opts.Interval)
+	}
+	if opts.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Duration)
+		defer cancel()
+	}
+	start := time.Now()
+	failures := 0
+	for opts.Count <= 0 || count < opts.Count {
+		row := &Row{Time: time.Now(), Values: map[string]string{}}
+		for _, f := range opts.Fields {
+			v, err := Sample(hds, f)
+			if err != nil {
+				if row.Errors == nil {
+					row.Errors = map[string]string{}
+				}
+				row.Errors[f] = err.Error()
+				continue
+			}
+			row.Values[f] = v
+		}
+		if len(row.Values) == 0 {
+			failures++
+			log.Printf("no value read at %v: %v\n", row.Time.Format(time.RFC3339), row.Errors)
+			if opts.MaxFailures > 0 && failures >= opts.MaxFailures {
+				return count, fmt.Errorf("failed to read any field %v times in a row", failures)
+			}
+		} else {
+			failures = 0
+		}
+		if err := fn(row); err != nil {
+			return count, err
+		}
+		count++
+		// rows are scheduled from the start time, so that the interval does not drift
+		next := start.Add(time.Duration(count) * opts.Interval)
+		if now := time.Now(); next.Before(now) {
+			next = now
+		}
+		select {
+		case <-ctx.Done():
+			return count, nil
+		case <-time.After(time.Until(next)):
+		}
+	}
+	return count, nil
+}
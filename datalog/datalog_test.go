@@ -0,0 +1,93 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package datalog
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/frnckdlprt/hdsctl"
+	"github.com/frnckdlprt/hdsctl/scpi"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_run(t *testing.T) {
+	hds := hdsctl.NewHDS(scpi.NewHDSClient(scpi.NewMockExecutor()))
+	opts := Options{Fields: []string{":CH1:SCALe", "horScal", ":MEASurement:CH1:PKPK"}, Interval: 10 * time.Millisecond, Count: 3}
+	rows := []*Row{}
+	n, err := Run(context.Background(), hds, opts, func(row *Row) error {
+		rows = append(rows, row)
+		return nil
+	})
+	if err != nil || n != 3 {
+		t.Fatalf("unexpected run: %v rows, %v", n, err)
+	}
+	r := rows[2]
+	if r.Values[":CH1:SCALe"] != "1.00V" || r.Values["horScal"] != "100us" || r.Errors[":MEASurement:CH1:PKPK"] == "" {
+		t.Fatalf("unexpected row: %v %v", r.Values, r.Errors)
+	}
+	opts.Fields = []string{":MEASurement:CH1:PKPK"}
+	opts.MaxFailures = 2
+	if n, err = Run(context.Background(), hds, opts, func(row *Row) error { return nil }); err == nil || n != 1 {
+		t.Fatalf("expected a failure after 2 rows: %v rows, %v", n, err)
+	}
+}
+
+func Test_fileWriter(t *testing.T) {
+	dir := t.TempDir()
+	ts := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	fields := []string{"a", "b"}
+	fw := NewFileWriter(filepath.Join(dir, "log.csv"), fields)
+	fw.MaxAge = time.Minute
+	for i := 0; i < 3; i++ {
+		row := &Row{Time: ts.Add(time.Duration(i) * 40 * time.Second), Values: map[string]string{"a": "1", "b": "2,5"}}
+		if err := fw.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "log-20230501-120000.000.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "time,a,b\n2023-05-01T12:00:00Z,1,\"2,5\"\n2023-05-01T12:00:40Z,1,\"2,5\"\n" {
+		t.Fatalf("unexpected csv: %q", b)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "log-20230501-120120.000.csv")); err != nil {
+		t.Fatalf("file not rotated: %v", err)
+	}
+	fw = NewFileWriter(filepath.Join(dir, "log.ndjson"), fields)
+	fw.Write(&Row{Time: ts, Values: map[string]string{"a": "1"}, Errors: map[string]string{"b": "timeout"}})
+	fw.Close()
+	f, err := os.Open(filepath.Join(dir, "log.ndjson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	s.Scan()
+	row := &Row{}
+	if err := json.Unmarshal(s.Bytes(), row); err != nil || row.Errors["b"] != "timeout" || !strings.Contains(s.Text(), `"a":"1"`) {
+		t.Fatalf("unexpected ndjson: %s %v", s.Text(), err)
+	}
+}
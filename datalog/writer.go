@@ -0,0 +1,140 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package datalog
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FileWriter appends rows to a csv file, or to a ndjson file when the extension is .ndjson or .jsonl.
+// When rotation is enabled, a new file named after its creation time is started once the current
+// one reaches MaxSize bytes or MaxAge.
+type FileWriter struct {
+	Path   string
+	Fields []string
+	// rotation limits, no rotation when both are 0
+	MaxSize int64
+	MaxAge  time.Duration
+	file    *os.File
+	name    string
+	size    int64
+	opened  time.Time
+}
+
+func NewFileWriter(path string, fields []string) *FileWriter {
+	return &FileWriter{Path: path, Fields: fields}
+}
+
+func (fw *FileWriter) ndjson() bool {
+	ext := strings.ToLower(filepath.Ext(fw.Path))
+	return ext == ".ndjson" || ext == ".jsonl"
+}
+
+// Name returns the name of the current file.
+func (fw *FileWriter) Name() string {
+	return fw.name
+}
+
+func (fw *FileWriter) Write(row *Row) error {
+	if fw.file != nil && fw.rotate(row.Time) {
+		if err := fw.Close(); err != nil {
+			return err
+		}
+	}
+	if fw.file == nil {
+		if err := fw.open(row.Time); err != nil {
+			return err
+		}
+	}
+	var line []byte
+	if fw.ndjson() {
+		b, err := json.Marshal(row)
+		if err != nil {
+			return fmt.Errorf("failed to encode row: %w", err)
+		}
+		line = append(b, '\n')
+	} else {
+		record := []string{row.Time.Format(time.RFC3339Nano)}
+		for _, f := range fw.Fields {
+			record = append(record, row.Values[f])
+		}
+		line = csvLine(record)
+	}
+	n, err := fw.file.Write(line)
+	fw.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", fw.name, err)
+	}
+	return nil
+}
+
+func (fw *FileWriter) Close() error {
+	if fw.file == nil {
+		return nil
+	}
+	err := fw.file.Close()
+	fw.file = nil
+	if err != nil {
+		return fmt.Errorf("failed to close %s: %w", fw.name, err)
+	}
+	return nil
+}
+
+func (fw *FileWriter) rotate(t time.Time) bool {
+	return (fw.MaxSize > 0 && fw.size >= fw.MaxSize) || (fw.MaxAge > 0 && t.Sub(fw.opened) >= fw.MaxAge)
+}
+
+func (fw *FileWriter) open(t time.Time) error {
+	fw.name = fw.Path
+	if fw.MaxSize > 0 || fw.MaxAge > 0 {
+		ext := filepath.Ext(fw.Path)
+		fw.name = fmt.Sprintf("%s-%s%s", strings.TrimSuffix(fw.Path, ext), t.Format("20060102-150405.000"), ext)
+	}
+	f, err := os.OpenFile(fw.name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", fw.name, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to open %s: %w", fw.name, err)
+	}
+	fw.file, fw.size, fw.opened = f, info.Size(), t
+	// csv files start with the column names
+	if !fw.ndjson() && fw.size == 0 {
+		n, err := f.Write(csvLine(append([]string{"time"}, fw.Fields...)))
+		fw.size += int64(n)
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", fw.name, err)
+		}
+	}
+	return nil
+}
+
+func csvLine(record []string) []byte {
+	b := &strings.Builder{}
+	w := csv.NewWriter(b)
+	w.Write(record)
+	w.Flush()
+	return []byte(b.String())
+}
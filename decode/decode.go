@@ -0,0 +1,125 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package decode
+
+import (
+	"fmt"
+	"github.com/frnckdlprt/hdsctl/measure"
+	"github.com/frnckdlprt/hdsctl/waveform"
+	"math"
+)
+
+// Event is a decoded protocol element, such as a byte, a start or a stop condition.
+type Event struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Kind  string  `json:"kind"`
+	Value int     `json:"value"`
+	Text  string  `json:"text"`
+	Error string  `json:"error,omitempty"`
+}
+
+func (e Event) String() string {
+	s := fmt.Sprintf("%12.6fms %-8s %s", e.Start*1e3, e.Kind, e.Text)
+	if e.Error != "" {
+		s += " (" + e.Error + ")"
+	}
+	return s
+}
+
+// Digital is a waveform converted to logic levels.
+type Digital struct {
+	Start    float64
+	Interval float64
+	Levels   []bool
+}
+
+// Thresholds returns the low and high thresholds of the waveform at 30% and 70% of its amplitude.
+func Thresholds(w *waveform.Waveform) (low, high float64, err error) {
+	amp := measure.Amplitude(w)
+	if !amp.Valid {
+		return 0, 0, fmt.Errorf("%s has no transition", w.Name)
+	}
+	base := measure.Base(w).Value
+	return base + 0.3*amp.Value, base + 0.7*amp.Value, nil
+}
+
+// Digitize thresholds the waveform with hysteresis: the level only changes when the waveform
+// goes above high or below low. When both thresholds are 0, they are computed from the waveform.
+func Digitize(w *waveform.Waveform, low, high float64) (*Digital, error) {
+	if low == 0 && high == 0 {
+		var err error
+		low, high, err = Thresholds(w)
+		if err != nil {
+			return nil, err
+		}
+	}
+	d := &Digital{Start: w.Start, Interval: w.Interval, Levels: make([]bool, len(w.Samples))}
+	level := len(w.Samples) > 0 && w.Samples[0] > (low+high)/2
+	for i, v := range w.Samples {
+		if v > high {
+			level = true
+		} else if v < low {
+			level = false
+		}
+		d.Levels[i] = level
+	}
+	return d, nil
+}
+
+func (d *Digital) Time(i int) float64 {
+	return d.Start + float64(i)*d.Interval
+}
+
+// Index returns the sample index at time t, and false when t is out of the waveform.
+func (d *Digital) Index(t float64) (int, bool) {
+	i := int(math.Round((t - d.Start) / d.Interval))
+	return i, i >= 0 && i < len(d.Levels)
+}
+
+// At returns the level at time t.
+func (d *Digital) At(t float64) (level bool, ok bool) {
+	i, ok := d.Index(t)
+	if !ok {
+		return false, false
+	}
+	return d.Levels[i], true
+}
+
+// Edges returns the indexes where the level changes.
+func (d *Digital) Edges() []int {
+	result := []int{}
+	for i := 1; i < len(d.Levels); i++ {
+		if d.Levels[i] != d.Levels[i-1] {
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+// NextEdge returns the index of the first change to level at or after index i, or -1.
+func (d *Digital) NextEdge(i int, level bool) int {
+	if i < 1 {
+		i = 1
+	}
+	for ; i < len(d.Levels); i++ {
+		if d.Levels[i] == level && d.Levels[i-1] != level {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,397 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package decode
+
+import (
+	"fmt"
+	"github.com/frnckdlprt/hdsctl/waveform"
+	"math"
+	"strings"
+	"testing"
+)
+
+// signal builds a waveform from a list of levels, each lasting the given number of samples
+type signal struct {
+	w *waveform.Waveform
+}
+
+func newSignal(interval float64) *signal {
+	return &signal{w: &waveform.Waveform{Name: "CH1", Unit: "V", Interval: interval}}
+}
+
+func (s *signal) add(level bool, n int) *signal {
+	v := 0.1
+	if level {
+		v = 3.3
+	}
+	for i := 0; i < n; i++ {
+		s.w.Samples = append(s.w.Samples, v)
+	}
+	return s
+}
+
+// uart appends a frame of 8 data bits, with an optional parity bit, and one stop bit
+func (s *signal) uart(v int, parity *bool, samplesPerBit int) *signal {
+	return s.uartFrame(v, 8, parity, 1, samplesPerBit)
+}
+
+func (s *signal) uartFrame(v, dataBits int, parity *bool, stopBits, samplesPerBit int) *signal {
+	s.add(false, samplesPerBit)
+	for b := 0; b < dataBits; b++ {
+		s.add(v&(1<<b) != 0, samplesPerBit)
+	}
+	if parity != nil {
+		s.add(*parity, samplesPerBit)
+	}
+	return s.add(true, stopBits*samplesPerBit)
+}
+
+func texts(events []Event) string {
+	result := []string{}
+	for _, e := range events {
+		t := e.Text
+		if e.Error != "" {
+			t += "!" + e.Error
+		}
+		result = append(result, t)
+	}
+	return strings.Join(result, ",")
+}
+
+func Test_uart(t *testing.T) {
+	s := newSignal(1.0/(9600*8)).add(true, 20)
+	for _, c := range "Hi!" {
+		s.uart(int(c), nil, 8).add(true, 5)
+	}
+	events, cfg, err := UART(s.w, DefaultUARTConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Baud != 9600 || texts(events) != "0x48 'H',0x69 'i',0x21 '!'" {
+		t.Fatalf("unexpected decoding at %v bauds: %v", cfg.Baud, texts(events))
+	}
+	if math.Abs(events[0].Start-20*s.w.Interval) > s.w.Interval {
+		t.Fatalf("unexpected byte start: %v", events[0].Start)
+	}
+}
+
+func Test_uartParity(t *testing.T) {
+	even, odd := false, true
+	// 0x03 has two ones: the even parity bit is 0
+	s := newSignal(1e-6).add(true, 10).uart(0x03, &even, 10).add(true, 10).uart(0x03, &odd, 10).add(true, 10)
+	cfg := DefaultUARTConfig()
+	cfg.Baud = 100000
+	cfg.Parity = ParityEven
+	events, _, err := UART(s.w, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if texts(events) != "0x03,0x03!parity error" {
+		t.Fatalf("unexpected decoding: %v", texts(events))
+	}
+}
+
+func Test_uartFormat(t *testing.T) {
+	for _, test := range []struct {
+		format   string
+		dataBits int
+		parity   Parity
+		stopBits int
+	}{
+		{"8N1", 8, ParityNone, 1},
+		{"8E1", 8, ParityEven, 1},
+		{"7O1", 7, ParityOdd, 1},
+		{"7E2", 7, ParityEven, 2},
+		{"8N2", 8, ParityNone, 2},
+	} {
+		// back to back bytes, so that the stop bits can be told from an idle line
+		s := newSignal(1e-6).add(true, 20)
+		for _, c := range "Hello, world" {
+			v := int(c) & (1<<test.dataBits - 1)
+			var parity *bool
+			if test.parity != ParityNone {
+				odd := strings.Count(fmt.Sprintf("%b", v), "1")%2 == 1
+				p := odd == (test.parity == ParityEven)
+				parity = &p
+			}
+			s.uartFrame(v, test.dataBits, parity, test.stopBits, 10)
+		}
+		s.add(true, 20)
+		cfg := DefaultUARTConfig()
+		if err := cfg.SetFormat("auto"); err != nil {
+			t.Fatal(err)
+		}
+		events, cfg, err := UART(s.w, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Format() != test.format || len(events) != 12 || events[0].Value != 'H' || events[0].Error != "" {
+			t.Fatalf("unexpected %s detection: %v %v", test.format, cfg.Format(), texts(events))
+		}
+		frameBits := 1 + test.dataBits + test.stopBits
+		if test.parity != ParityNone {
+			frameBits++
+		}
+		if d := events[0].End - events[0].Start; math.Abs(d-float64(frameBits)*10e-6) > 1e-9 {
+			t.Fatalf("unexpected %s frame duration: %v", test.format, d)
+		}
+	}
+	cfg := DefaultUARTConfig()
+	if err := cfg.SetFormat("7X1"); err == nil {
+		t.Fatalf("expected invalid format")
+	}
+	if err := cfg.SetFormat("9n2"); err != nil || cfg.Format() != "9N2" {
+		t.Fatalf("unexpected format: %v", cfg.Format())
+	}
+}
+
+// bus builds the SCL and SDA waveforms of an I2C bus, each clock phase lasting half samples
+type bus struct {
+	scl, sda *signal
+	half     int
+}
+
+func newBus(interval float64, half int) *bus {
+	return &bus{scl: newSignal(interval), sda: newSignal(interval), half: half}
+}
+
+func (b *bus) add(scl, sda bool, n int) *bus {
+	b.scl.add(scl, n)
+	b.sda.add(sda, n)
+	return b
+}
+
+// start holds SDA low for the given number of samples before the clock goes low
+func (b *bus) start(hold int) *bus {
+	return b.add(true, false, hold)
+}
+
+func (b *bus) restart() *bus {
+	return b.add(false, true, b.half).add(true, true, b.half).start(b.half)
+}
+
+func (b *bus) bit(v bool) *bus {
+	return b.add(false, v, b.half).add(true, v, b.half)
+}
+
+func (b *bus) byte(v int, nack bool) *bus {
+	for i := 7; i >= 0; i-- {
+		b.bit(v&(1<<i) != 0)
+	}
+	return b.bit(nack)
+}
+
+func (b *bus) stop() *bus {
+	return b.add(false, false, b.half).add(true, false, b.half).add(true, true, 1)
+}
+
+func Test_i2c(t *testing.T) {
+	b := newBus(1e-6, 5).add(true, true, 20).start(5).byte(0x50<<1, false).byte(0x01, false).
+		restart().byte(0x50<<1|1, false).byte(0x42, true).stop().add(true, true, 20)
+	events, err := I2C(b.scl.w, b.sda.w, DefaultI2CConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "S,0x50 W,ACK,0x01,ACK,Sr,0x50 R,ACK,0x42,NACK,P"
+	if texts(events) != expected {
+		t.Fatalf("unexpected decoding: %v", texts(events))
+	}
+	if events[1].Kind != "address" || events[1].Value != 0x50 || events[3].Kind != "data" || events[3].Value != 0x01 {
+		t.Fatalf("unexpected events: %v", events)
+	}
+}
+
+func Test_i2cTiming(t *testing.T) {
+	// start hold and bus free times of 2us and 4us, below the standard mode minimums but above the fast mode ones
+	b := newBus(1e-6, 5).add(true, true, 20).start(1).byte(0x50<<1, false).stop().add(true, true, 2).
+		start(5).byte(0x50<<1, true).stop().add(true, true, 20)
+	events, err := I2C(b.scl.w, b.sda.w, DefaultI2CConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "S!start hold time violation,0x50 W,ACK,P,S!bus free time violation,0x50 W,NACK,P"
+	if texts(events) != expected {
+		t.Fatalf("unexpected decoding: %v", texts(events))
+	}
+	events, _ = I2C(b.scl.w, b.sda.w, FastModeI2CConfig())
+	if texts(events) != "S,0x50 W,ACK,P,S,0x50 W,NACK,P" {
+		t.Fatalf("unexpected fast mode decoding: %v", texts(events))
+	}
+}
+
+// spi appends a transfer of 8 bits words, MSB first, with the given clock polarity and phase
+func (b *bus) spi(cpol, cpha bool, words ...int) *bus {
+	for _, w := range words {
+		for i := 7; i >= 0; i-- {
+			v := w&(1<<i) != 0
+			if cpha {
+				// data changes on the leading edge and is sampled on the trailing edge
+				b.add(!cpol, v, b.half).add(cpol, v, b.half)
+			} else {
+				b.add(cpol, v, b.half).add(!cpol, v, b.half)
+			}
+		}
+	}
+	return b.add(cpol, false, b.half)
+}
+
+func Test_spi(t *testing.T) {
+	b := newBus(1e-6, 2).add(false, false, 20).spi(false, false, 0xA5, 0x3C).add(false, false, 40).spi(false, false, 0x01).add(false, false, 20)
+	events, err := SPI(b.scl.w, b.sda.w, DefaultSPIConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if texts(events) != "0xA5,0x3C,0x01" {
+		t.Fatalf("unexpected decoding: %v", texts(events))
+	}
+	cfg := DefaultSPIConfig()
+	cfg.LSBFirst = true
+	cfg.WordBits = 4
+	events, _ = SPI(b.scl.w, b.sda.w, cfg)
+	if texts(events) != "0x5,0xA,0xC,0x3,0x0,0x8" {
+		t.Fatalf("unexpected lsb first decoding: %v", texts(events))
+	}
+}
+
+func Test_spiMode3(t *testing.T) {
+	// the capture starts during a transfer
+	b := newBus(1e-6, 2).spi(true, true, 0x55).add(true, false, 40).spi(true, true, 0x42).add(true, false, 20)
+	cfg := DefaultSPIConfig()
+	if err := cfg.SetMode(3); err != nil {
+		t.Fatal(err)
+	}
+	events, err := SPI(b.scl.w, b.sda.w, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if texts(events) != "0x55!transfer started before the capture,0x42" {
+		t.Fatalf("unexpected decoding: %v", texts(events))
+	}
+}
+
+// oneWire appends the write or read slots of the bytes, least significant bit first, with 1us samples
+func (s *signal) oneWire(bytes ...int) *signal {
+	for _, v := range bytes {
+		for b := 0; b < 8; b++ {
+			if v&(1<<b) != 0 {
+				s.add(false, 5).add(true, 60)
+			} else {
+				s.add(false, 65).add(true, 5)
+			}
+		}
+	}
+	return s
+}
+
+func (s *signal) oneWireReset() *signal {
+	return s.add(false, 500).add(true, 30).add(false, 120).add(true, 300)
+}
+
+func Test_oneWire(t *testing.T) {
+	rom := []int{0x28, 0xff, 0x9c, 0x79, 0xa2, 0x16, 0x03}
+	rom = append(rom, crc8(rom))
+	s := newSignal(1e-6).add(true, 100).oneWireReset().oneWire(0xCC, 0x44).add(true, 1000).
+		oneWireReset().oneWire(0x33).oneWire(rom...).oneWire(0xBE).add(true, 100)
+	events, err := OneWire(s.w, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "RESET PRESENCE,0xCC Skip ROM,0x44,RESET PRESENCE,0x33 Read ROM,28-0316a2799cff,0xBE"
+	if texts(events) != expected {
+		t.Fatalf("unexpected decoding: %v", texts(events))
+	}
+}
+
+func Test_oneWireSearch(t *testing.T) {
+	rom := []int{0x28, 0xff, 0x9c, 0x79, 0xa2, 0x16, 0x03, 0x00}
+	s := newSignal(1e-6).add(true, 100).oneWireReset().oneWire(0xF0)
+	for b := 0; b < 64; b++ {
+		bit := rom[b/8]&(1<<(b%8)) != 0
+		for _, v := range []bool{bit, !bit, bit} {
+			if v {
+				s.add(false, 5).add(true, 60)
+			} else {
+				s.add(false, 65).add(true, 5)
+			}
+		}
+	}
+	s.add(false, 30).add(true, 100)
+	events, err := OneWire(s.w, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "RESET PRESENCE,0xF0 Search ROM,28-0316a2799cff!crc error"
+	if texts(events) != expected {
+		t.Fatalf("unexpected decoding: %v", texts(events))
+	}
+}
+
+func Test_ws2812(t *testing.T) {
+	s := newSignal(0.05e-6).add(false, 100)
+	grb := func(colors ...int) {
+		for _, c := range colors {
+			for b := 23; b >= 0; b-- {
+				if c&(1<<b) != 0 {
+					s.add(true, 16).add(false, 9)
+				} else {
+					s.add(true, 8).add(false, 17)
+				}
+			}
+		}
+	}
+	// red then blue, a reset, and green
+	grb(0x00FF00, 0x0000FF)
+	s.add(false, 1200)
+	grb(0x800000)
+	s.add(false, 100)
+	events, err := WS2812(s.w, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if texts(events) != "0 #FF0000,1 #0000FF,RESET,0 #008000" {
+		t.Fatalf("unexpected decoding: %v", texts(events))
+	}
+}
+
+func Test_dht(t *testing.T) {
+	frame := func(s *signal, bytes ...int) {
+		s.add(false, 1000).add(true, 15).add(false, 40).add(true, 40)
+		for _, v := range bytes {
+			for b := 7; b >= 0; b-- {
+				s.add(false, 25)
+				if v&(1<<b) != 0 {
+					s.add(true, 35)
+				} else {
+					s.add(true, 13)
+				}
+			}
+		}
+		s.add(false, 25).add(true, 100)
+	}
+	// 65.2% and -10.1°C, then a wrong checksum
+	s := newSignal(2e-6).add(true, 100)
+	frame(s, 0x02, 0x8c, 0x80, 0x65, 0x73)
+	frame(s, 0x02, 0x8c, 0x00, 0x65, 0x00)
+	events, err := DHT(s.w, DHT22, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "START,RESPONSE,65.2 %RH,-10.1 °C,0x73,START,RESPONSE,65.2 %RH,10.1 °C,0x00!checksum error"
+	if texts(events) != expected {
+		t.Fatalf("unexpected decoding: %v", texts(events))
+	}
+}
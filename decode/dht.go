@@ -0,0 +1,114 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package decode
+
+import (
+	"fmt"
+	"github.com/frnckdlprt/hdsctl/waveform"
+	"strings"
+)
+
+type DHTModel int
+
+const (
+	DHT11 DHTModel = iota
+	DHT22
+)
+
+func ParseDHTModel(s string) (DHTModel, error) {
+	switch strings.ToLower(s) {
+	case "dht11", "11":
+		return DHT11, nil
+	case "dht22", "22", "am2302":
+		return DHT22, nil
+	}
+	return 0, fmt.Errorf("invalid dht model: %s", s)
+}
+
+// DHT frames start with a low pulse of the host, followed by a response of the sensor and 40 bits,
+// each bit being a low pulse followed by a high pulse whose width gives its value. The high pulse
+// of the response (80us) can not be told apart from a 1 (70us), it is found by its position.
+var dhtClasses = []PulseClass{
+	{Name: "start", Level: false, Min: 0.8e-3, Max: 30e-3},
+	{Name: "response", Level: false, Min: 60e-6, Max: 100e-6},
+	{Name: "separator", Level: false, Min: 30e-6, Max: 60e-6},
+	{Name: "0", Level: true, Min: 10e-6, Max: 45e-6},
+	{Name: "1", Level: true, Min: 55e-6, Max: 100e-6},
+}
+
+// DHT decodes the frames of DHT11 or DHT22 sensors, reporting the humidity, temperature and
+// checksum of each frame. Humidity and temperature values are in tenths of % and °C.
+func DHT(w *waveform.Waveform, model DHTModel, low, high float64) ([]Event, error) {
+	pulses, err := ClassifyPulses(w, low, high, dhtClasses)
+	if err != nil {
+		return nil, err
+	}
+	events := []Event{}
+	for i := 0; i < len(pulses); i++ {
+		if pulses[i].Class != "start" {
+			continue
+		}
+		events = append(events, Event{Start: pulses[i].Start, End: pulses[i].End, Kind: "start", Text: "START"})
+		// the host releases the line, then the sensor pulls it low and high
+		j := i + 2
+		if j+1 >= len(pulses) || pulses[j].Class != "response" || pulses[j+1].Class != "1" {
+			events[len(events)-1].Error = "no response"
+			continue
+		}
+		events = append(events, Event{Start: pulses[j].Start, End: pulses[j+1].End, Kind: "response", Text: "RESPONSE"})
+		bits, starts := []bool{}, []float64{}
+		for j += 2; j+1 < len(pulses) && len(bits) < 40; j += 2 {
+			if pulses[j].Class != "separator" || (pulses[j+1].Class != "0" && pulses[j+1].Class != "1") {
+				break
+			}
+			bits = append(bits, pulses[j+1].Class == "1")
+			starts = append(starts, pulses[j].Start)
+		}
+		i = j - 1
+		if len(bits) < 40 {
+			end := pulses[i].End
+			events = append(events, Event{Start: pulses[i].Start, End: end, Kind: "error", Text: fmt.Sprintf("%v bits", len(bits)), Error: "incomplete frame"})
+			continue
+		}
+		b := make([]int, 5)
+		for k := range b {
+			b[k] = bitsValue(bits[k*8 : k*8+8])
+		}
+		var humidity, temperature int
+		if model == DHT11 {
+			humidity, temperature = b[0]*10+b[1], b[2]*10+b[3]
+			if b[3]&0x80 != 0 {
+				temperature = -(b[2]*10 + b[3]&0x7f)
+			}
+		} else {
+			humidity, temperature = b[0]<<8|b[1], (b[2]&0x7f)<<8|b[3]
+			if b[2]&0x80 != 0 {
+				temperature = -temperature
+			}
+		}
+		end := pulses[i].End
+		events = append(events,
+			Event{Start: starts[0], End: starts[16], Kind: "humidity", Value: humidity, Text: fmt.Sprintf("%.1f %%RH", float64(humidity)/10)},
+			Event{Start: starts[16], End: starts[32], Kind: "temperature", Value: temperature, Text: fmt.Sprintf("%.1f °C", float64(temperature)/10)})
+		checksum := Event{Start: starts[32], End: end, Kind: "checksum", Value: b[4], Text: fmt.Sprintf("0x%02X", b[4])}
+		if (b[0]+b[1]+b[2]+b[3])&0xff != b[4] {
+			checksum.Error = "checksum error"
+		}
+		events = append(events, checksum)
+	}
+	return events, nil
+}
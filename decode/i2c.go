@@ -0,0 +1,240 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package decode
+
+import (
+	"fmt"
+	"github.com/frnckdlprt/hdsctl/waveform"
+	"strings"
+)
+
+// I2CConfig holds the digitizing thresholds and the minimum bus timings, a timing is not checked when 0.
+type I2CConfig struct {
+	// digitizing thresholds, computed from each waveform when both are 0
+	Low, High float64
+	// data setup time before the SCL rising edge
+	MinDataSetup float64
+	// hold time of a (repeated) start condition before the first SCL falling edge
+	MinStartHold float64
+	// setup time of a stop condition after the SCL rising edge
+	MinStopSetup float64
+	// bus free time between a stop and a start condition
+	MinBusFree float64
+}
+
+// DefaultI2CConfig checks the standard mode (100kHz) timings.
+func DefaultI2CConfig() I2CConfig {
+	return I2CConfig{MinDataSetup: 250e-9, MinStartHold: 4e-6, MinStopSetup: 4e-6, MinBusFree: 4.7e-6}
+}
+
+func FastModeI2CConfig() I2CConfig {
+	return I2CConfig{MinDataSetup: 100e-9, MinStartHold: 0.6e-6, MinStopSetup: 0.6e-6, MinBusFree: 1.3e-6}
+}
+
+// ParseI2CMode returns the configuration of a bus mode: standard, fast or none to skip the timing checks.
+func ParseI2CMode(s string) (I2CConfig, error) {
+	switch strings.ToLower(s) {
+	case "standard", "sm":
+		return DefaultI2CConfig(), nil
+	case "fast", "fm":
+		return FastModeI2CConfig(), nil
+	case "none", "":
+		return I2CConfig{}, nil
+	}
+	return I2CConfig{}, fmt.Errorf("invalid i2c mode: %s", s)
+}
+
+// i2cDecoder holds the state of a transaction while walking the samples
+type i2cDecoder struct {
+	cfg      I2CConfig
+	scl, sda *Digital
+	events   []Event
+	// index of the last start event, -1 outside of a transaction
+	start     int
+	startTime float64
+	// index of the last stop condition, -1 before the first one
+	stopIndex int
+	// bits of the current byte, and the pending bit sampled on the last SCL rising edge
+	bits      []bool
+	pending   bool
+	bit       bool
+	byteStart float64
+	byteEnd   float64
+	byteCount int
+	lastFall  float64
+	lastRise  int
+	lastSDA   int
+	violation string
+}
+
+// I2C decodes the start and stop conditions, addresses, data bytes and acknowledges of an I2C bus.
+// Timings are measured at the sample resolution, and a violation is only reported when it is
+// certain, that is when the measured time plus one sample interval is below the minimum.
+func I2C(scl, sda *waveform.Waveform, cfg I2CConfig) ([]Event, error) {
+	if len(scl.Samples) != len(sda.Samples) || scl.Interval != sda.Interval {
+		return nil, fmt.Errorf("%s and %s do not share the same time base", scl.Name, sda.Name)
+	}
+	dscl, err := Digitize(scl, cfg.Low, cfg.High)
+	if err != nil {
+		return nil, err
+	}
+	dsda, err := Digitize(sda, cfg.Low, cfg.High)
+	if err != nil {
+		return nil, err
+	}
+	dec := &i2cDecoder{cfg: cfg, scl: dscl, sda: dsda, events: []Event{}, start: -1, stopIndex: -1}
+	dec.run()
+	return dec.events, nil
+}
+
+func (dec *i2cDecoder) run() {
+	scl, sda := dec.scl.Levels, dec.sda.Levels
+	for i := 1; i < len(scl); i++ {
+		if sda[i] != sda[i-1] {
+			if scl[i] && scl[i-1] {
+				if sda[i] {
+					dec.stop(i)
+				} else {
+					dec.startCondition(i)
+				}
+			}
+			dec.lastSDA = i
+		}
+		if scl[i] && !scl[i-1] {
+			dec.rise(i)
+		}
+		if !scl[i] && scl[i-1] {
+			dec.fall(i)
+		}
+	}
+}
+
+// tooShort returns whether the time between the two sample indexes is certainly below min
+func (dec *i2cDecoder) tooShort(from, to int, min float64) bool {
+	return min > 0 && float64(to-from+1)*dec.scl.Interval < min
+}
+
+func (dec *i2cDecoder) startCondition(i int) {
+	t := dec.scl.Time(i)
+	e := Event{Start: t, End: t, Kind: "start", Text: "S"}
+	if dec.start >= 0 {
+		dec.incomplete(t)
+		e.Kind, e.Text = "restart", "Sr"
+	} else if dec.stopIndex >= 0 && dec.tooShort(dec.stopIndex, i, dec.cfg.MinBusFree) {
+		e.Error = "bus free time violation"
+	}
+	dec.events = append(dec.events, e)
+	dec.start = len(dec.events) - 1
+	dec.startTime = t
+	dec.bits = nil
+	dec.pending = false
+	dec.byteCount = 0
+	dec.violation = ""
+	dec.lastFall = t
+}
+
+func (dec *i2cDecoder) stop(i int) {
+	if dec.start < 0 {
+		return
+	}
+	t := dec.scl.Time(i)
+	dec.incomplete(t)
+	e := Event{Start: t, End: t, Kind: "stop", Text: "P"}
+	if dec.tooShort(dec.lastRise, i, dec.cfg.MinStopSetup) {
+		e.Error = "stop setup time violation"
+	}
+	dec.events = append(dec.events, e)
+	dec.start = -1
+	dec.stopIndex = i
+	dec.bits = nil
+	dec.pending = false
+}
+
+// incomplete reports the bits received before a start or stop condition interrupted a byte
+func (dec *i2cDecoder) incomplete(t float64) {
+	if len(dec.bits) > 0 && len(dec.bits) < 8 {
+		dec.events = append(dec.events, Event{Start: dec.byteStart, End: t, Kind: "error", Text: fmt.Sprintf("%v bits", len(dec.bits)), Error: "incomplete byte"})
+	}
+}
+
+func (dec *i2cDecoder) rise(i int) {
+	dec.lastRise = i
+	if dec.start < 0 {
+		return
+	}
+	dec.pending = true
+	dec.bit = dec.sda.Levels[i]
+	lastFall, _ := dec.scl.Index(dec.lastFall)
+	if dec.lastSDA > lastFall && dec.tooShort(dec.lastSDA, i, dec.cfg.MinDataSetup) {
+		dec.violation = "data setup time violation"
+	}
+}
+
+func (dec *i2cDecoder) fall(i int) {
+	t := dec.scl.Time(i)
+	defer func() { dec.lastFall = t }()
+	if dec.start < 0 {
+		return
+	}
+	if dec.byteCount == 0 && len(dec.bits) == 0 && !dec.pending && dec.lastFall == dec.startTime {
+		start, _ := dec.scl.Index(dec.startTime)
+		if dec.tooShort(start, i, dec.cfg.MinStartHold) {
+			dec.events[dec.start].Error = "start hold time violation"
+		}
+	}
+	if !dec.pending {
+		return
+	}
+	dec.pending = false
+	dec.bits = append(dec.bits, dec.bit)
+	switch len(dec.bits) {
+	case 1:
+		dec.byteStart = dec.lastFall
+	case 8:
+		value := 0
+		for _, b := range dec.bits {
+			value = value<<1 | boolInt(b)
+		}
+		e := Event{Start: dec.byteStart, End: t, Kind: "data", Value: value, Text: fmt.Sprintf("0x%02X", value), Error: dec.violation}
+		if dec.byteCount == 0 {
+			rw := "W"
+			if value&1 == 1 {
+				rw = "R"
+			}
+			e.Kind, e.Value, e.Text = "address", value>>1, fmt.Sprintf("0x%02X %s", value>>1, rw)
+		}
+		dec.events = append(dec.events, e)
+		dec.byteEnd = t
+		dec.violation = ""
+	case 9:
+		e := Event{Start: dec.byteEnd, End: t, Kind: "ack", Text: "ACK", Error: dec.violation}
+		if dec.bit {
+			e.Kind, e.Value, e.Text = "nack", 1, "NACK"
+		}
+		dec.events = append(dec.events, e)
+		dec.bits = nil
+		dec.byteCount++
+		dec.violation = ""
+	}
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
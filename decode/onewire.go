@@ -0,0 +1,184 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package decode
+
+import (
+	"fmt"
+	"github.com/frnckdlprt/hdsctl/waveform"
+)
+
+// 1-Wire standard speed time slots, the bus idles high and every slot starts with a low pulse
+var oneWireClasses = []PulseClass{
+	{Name: "reset", Level: false, Min: 440e-6},
+	// a write 0 slot, a read 0 slot or a presence pulse
+	{Name: "0", Level: false, Min: 15e-6, Max: 300e-6},
+	{Name: "1", Level: false, Max: 15e-6},
+}
+
+// maximum delay between the end of a reset and the presence pulse
+const oneWirePresenceDelay = 75e-6
+
+var oneWireROMCommands = map[int]string{
+	0x33: "Read ROM",
+	0x55: "Match ROM",
+	0xCC: "Skip ROM",
+	0xF0: "Search ROM",
+	0xEC: "Alarm Search",
+	0x3C: "Overdrive Skip ROM",
+	0x69: "Overdrive Match ROM",
+}
+
+type oneWireDecoder struct {
+	events []Event
+	// bits of the current byte, or of the current search
+	bits      []bool
+	bitsStart float64
+	// bytes since the last reset, -1 before the first reset
+	count    int
+	command  int
+	rom      []int
+	romStart float64
+	presence int
+}
+
+// OneWire decodes the resets, presence pulses, ROM commands, ROM codes and data bytes of a
+// 1-Wire bus at standard speed. The ROM code of a search is rebuilt from the direction bits.
+func OneWire(w *waveform.Waveform, low, high float64) ([]Event, error) {
+	pulses, err := ClassifyPulses(w, low, high, oneWireClasses)
+	if err != nil {
+		return nil, err
+	}
+	dec := &oneWireDecoder{events: []Event{}, count: -1, presence: -1}
+	for i, p := range pulses {
+		switch {
+		case p.Class == "reset":
+			dec.reset(pulses, i)
+		case i == dec.presence || dec.count < 0:
+			// the presence pulse, or slots before the first reset
+		case p.Class == "0" || p.Class == "1":
+			dec.bit(p)
+		case !p.Level:
+			dec.incomplete(p.Start)
+			dec.events = append(dec.events, Event{Start: p.Start, End: p.End, Kind: "error", Text: fmt.Sprintf("%.0fus low", p.Width()*1e6), Error: "invalid time slot"})
+		}
+	}
+	return dec.events, nil
+}
+
+func (dec *oneWireDecoder) reset(pulses []Pulse, i int) {
+	p := pulses[i]
+	dec.incomplete(p.Start)
+	e := Event{Start: p.Start, End: p.End, Kind: "reset", Text: "RESET"}
+	// the presence pulse follows the release of the bus by the master
+	if i+2 < len(pulses) && pulses[i+2].Class == "0" && pulses[i+2].Start-p.End < oneWirePresenceDelay {
+		dec.presence = i + 2
+		e.End = pulses[i+2].End
+		e.Text = "RESET PRESENCE"
+	} else {
+		e.Error = "no presence"
+	}
+	dec.events = append(dec.events, e)
+	dec.count, dec.command, dec.rom = 0, 0, nil
+}
+
+// incomplete reports the bits received before a reset or an invalid slot
+func (dec *oneWireDecoder) incomplete(end float64) {
+	if len(dec.bits) > 0 {
+		dec.events = append(dec.events, Event{Start: dec.bitsStart, End: end, Kind: "error", Text: fmt.Sprintf("%v bits", len(dec.bits)), Error: "incomplete byte"})
+	}
+	dec.bits = nil
+}
+
+func (dec *oneWireDecoder) bit(p Pulse) {
+	if len(dec.bits) == 0 {
+		dec.bitsStart = p.Start
+	}
+	dec.bits = append(dec.bits, p.Class == "1")
+	if dec.count == 1 && (dec.command == 0xF0 || dec.command == 0xEC) {
+		// search triplets: id bit, complement bit, and the direction chosen by the master
+		if len(dec.bits) < 64*3 {
+			return
+		}
+		rom := make([]int, 8)
+		for b := 0; b < 64; b++ {
+			rom[b/8] |= boolInt(dec.bits[b*3+2]) << (b % 8)
+		}
+		dec.events = append(dec.events, romEvent(rom, dec.bitsStart, p.End))
+		dec.bits = nil
+		dec.count++
+		return
+	}
+	if len(dec.bits) < 8 {
+		return
+	}
+	// least significant bit first
+	value := 0
+	for b, bit := range dec.bits {
+		value |= boolInt(bit) << b
+	}
+	start := dec.bitsStart
+	dec.bits = nil
+	dec.count++
+	switch {
+	case dec.count == 1:
+		dec.command = value
+		text := fmt.Sprintf("0x%02X", value)
+		if name, ok := oneWireROMCommands[value]; ok {
+			text += " " + name
+		}
+		dec.events = append(dec.events, Event{Start: start, End: p.End, Kind: "command", Value: value, Text: text})
+	case (dec.command == 0x33 || dec.command == 0x55 || dec.command == 0x69) && dec.count <= 9:
+		if len(dec.rom) == 0 {
+			dec.romStart = start
+		}
+		dec.rom = append(dec.rom, value)
+		if len(dec.rom) == 8 {
+			dec.events = append(dec.events, romEvent(dec.rom, dec.romStart, p.End))
+		}
+	default:
+		dec.events = append(dec.events, Event{Start: start, End: p.End, Kind: "data", Value: value, Text: fmt.Sprintf("0x%02X", value)})
+	}
+}
+
+// romEvent reports a ROM code as family-serial, its value being the family code
+func romEvent(rom []int, start, end float64) Event {
+	serial := ""
+	for i := 6; i >= 1; i-- {
+		serial += fmt.Sprintf("%02x", rom[i])
+	}
+	e := Event{Start: start, End: end, Kind: "rom", Value: rom[0], Text: fmt.Sprintf("%02x-%s", rom[0], serial)}
+	if crc8(rom[:7]) != rom[7] {
+		e.Error = "crc error"
+	}
+	return e
+}
+
+// crc8 is the Dallas/Maxim CRC of the ROM codes
+func crc8(data []int) int {
+	crc := 0
+	for _, b := range data {
+		for i := 0; i < 8; i++ {
+			mix := (crc ^ b) & 1
+			crc >>= 1
+			if mix != 0 {
+				crc ^= 0x8C
+			}
+			b >>= 1
+		}
+	}
+	return crc
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package decode
+
+import (
+	"github.com/frnckdlprt/hdsctl/waveform"
+)
+
+// PulseClass matches the pulses of a level within a width range, single wire protocols
+// are decoded from the sequence of classified pulses.
+type PulseClass struct {
+	Name  string
+	Level bool
+	// width range in seconds, Max is unbounded when 0
+	Min, Max float64
+}
+
+func (pc PulseClass) Match(p Pulse) bool {
+	width := p.Width()
+	return p.Level == pc.Level && width >= pc.Min && (pc.Max == 0 || width <= pc.Max)
+}
+
+// Pulse is a complete run of a level, between two edges.
+type Pulse struct {
+	Start float64
+	End   float64
+	Level bool
+	// name of the first matching class, empty when none matches
+	Class string
+}
+
+func (p Pulse) Width() float64 {
+	return p.End - p.Start
+}
+
+// Pulses returns the complete pulses of the signal, classified by the first matching class.
+// The levels before the first edge and after the last edge are not pulses.
+func (d *Digital) Pulses(classes []PulseClass) []Pulse {
+	result := []Pulse{}
+	edges := d.Edges()
+	for i := 1; i < len(edges); i++ {
+		// edges are at the middle of the sample interval of the transition
+		p := Pulse{Start: d.Time(edges[i-1]) - d.Interval/2, End: d.Time(edges[i]) - d.Interval/2, Level: d.Levels[edges[i-1]]}
+		for _, pc := range classes {
+			if pc.Match(p) {
+				p.Class = pc.Name
+				break
+			}
+		}
+		result = append(result, p)
+	}
+	return result
+}
+
+// ClassifyPulses digitizes the waveform and returns its classified pulses.
+func ClassifyPulses(w *waveform.Waveform, low, high float64, classes []PulseClass) ([]Pulse, error) {
+	d, err := Digitize(w, low, high)
+	if err != nil {
+		return nil, err
+	}
+	return d.Pulses(classes), nil
+}
+
+// bitsValue returns the value of the bits, most significant bit first
+func bitsValue(bits []bool) int {
+	value := 0
+	for _, b := range bits {
+		value = value<<1 | boolInt(b)
+	}
+	return value
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package decode
+
+import (
+	"fmt"
+	"github.com/frnckdlprt/hdsctl/waveform"
+	"sort"
+)
+
+// default idle gap framing the transfers, in clock periods
+const spiIdlePeriods = 4
+
+type SPIConfig struct {
+	// clock polarity: the clock idles high when 1
+	CPOL int
+	// clock phase: data is sampled on the second clock edge of a bit when 1
+	CPHA     int
+	LSBFirst bool
+	WordBits int
+	// idle time between clock edges ending a transfer, 4 clock periods when 0
+	IdleGap float64
+	// digitizing thresholds, computed from the clock when both are 0
+	Low, High float64
+}
+
+func DefaultSPIConfig() SPIConfig {
+	return SPIConfig{WordBits: 8}
+}
+
+// SetMode sets CPOL and CPHA from the SPI mode, 0 to 3.
+func (cfg *SPIConfig) SetMode(mode int) error {
+	if mode < 0 || mode > 3 {
+		return fmt.Errorf("invalid spi mode: %v", mode)
+	}
+	cfg.CPOL, cfg.CPHA = mode>>1, mode&1
+	return nil
+}
+
+// SPI decodes the words of a data line (MOSI or MISO) clocked by clk. Without a chip select,
+// transfers are framed by idle gaps of the clock, the words of a transfer that may have started
+// before the waveform are reported with an error.
+func SPI(clk, data *waveform.Waveform, cfg SPIConfig) ([]Event, error) {
+	if len(clk.Samples) != len(data.Samples) || clk.Interval != data.Interval {
+		return nil, fmt.Errorf("%s and %s do not share the same time base", clk.Name, data.Name)
+	}
+	if cfg.WordBits <= 0 || cfg.WordBits > 32 {
+		return nil, fmt.Errorf("invalid word size: %v", cfg.WordBits)
+	}
+	// the data line uses the thresholds of the clock, as it may have no transition
+	if cfg.Low == 0 && cfg.High == 0 {
+		var err error
+		cfg.Low, cfg.High, err = Thresholds(clk)
+		if err != nil {
+			return nil, err
+		}
+	}
+	dclk, err := Digitize(clk, cfg.Low, cfg.High)
+	if err != nil {
+		return nil, err
+	}
+	ddata, err := Digitize(data, cfg.Low, cfg.High)
+	if err != nil {
+		return nil, err
+	}
+	edges := dclk.Edges()
+	if len(edges) < 2 {
+		return []Event{}, nil
+	}
+	gap := int(cfg.IdleGap / dclk.Interval)
+	if cfg.IdleGap == 0 {
+		gap = spiIdlePeriods * clockPeriod(edges)
+	}
+	// data is sampled on rising edges in modes 0 and 3
+	risingSample := cfg.CPOL == cfg.CPHA
+	events := []Event{}
+	for from := 0; from < len(edges); {
+		to := from + 1
+		for to < len(edges) && edges[to]-edges[to-1] <= gap {
+			to++
+		}
+		truncated := edges[from] <= gap || dclk.Levels[edges[from]-1] != (cfg.CPOL == 1)
+		events = append(events, spiTransfer(dclk, ddata, edges[from:to], risingSample, truncated, cfg)...)
+		from = to
+	}
+	return events, nil
+}
+
+// spiTransfer decodes the words of the clock edges of a transfer
+func spiTransfer(clk, data *Digital, edges []int, risingSample, truncated bool, cfg SPIConfig) []Event {
+	events := []Event{}
+	value, bits := 0, 0
+	var start float64
+	for k, i := range edges {
+		if clk.Levels[i] != risingSample {
+			continue
+		}
+		if bits == 0 {
+			start = clk.Time(i)
+			if k > 0 {
+				start = clk.Time(edges[k-1])
+			}
+		}
+		bit := boolInt(data.Levels[i])
+		if cfg.LSBFirst {
+			value |= bit << bits
+		} else {
+			value = value<<1 | bit
+		}
+		bits++
+		if bits < cfg.WordBits {
+			continue
+		}
+		end := clk.Time(i)
+		if k+1 < len(edges) {
+			end = clk.Time(edges[k+1])
+		}
+		e := Event{Start: start, End: end, Kind: "word", Value: value, Text: fmt.Sprintf("0x%0*X", (cfg.WordBits+3)/4, value)}
+		if truncated {
+			e.Error = "transfer started before the capture"
+		}
+		events = append(events, e)
+		value, bits = 0, 0
+	}
+	if bits > 0 {
+		end := clk.Time(edges[len(edges)-1])
+		events = append(events, Event{Start: start, End: end, Kind: "error", Text: fmt.Sprintf("%v bits", bits), Error: "incomplete word"})
+	}
+	return events
+}
+
+// clockPeriod returns the median spacing of the clock edges of a same direction, in samples
+func clockPeriod(edges []int) int {
+	spacings := []int{}
+	for i := 2; i < len(edges); i++ {
+		spacings = append(spacings, edges[i]-edges[i-2])
+	}
+	if len(spacings) == 0 {
+		return edges[1] - edges[0]
+	}
+	sort.Ints(spacings)
+	return spacings[len(spacings)/2]
+}
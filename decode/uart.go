@@ -0,0 +1,266 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package decode
+
+import (
+	"fmt"
+	"github.com/frnckdlprt/hdsctl/waveform"
+	"math"
+	"strings"
+)
+
+type Parity int
+
+const (
+	ParityNone Parity = iota
+	ParityEven
+	ParityOdd
+)
+
+func ParseParity(s string) (Parity, error) {
+	switch strings.ToLower(s) {
+	case "none", "n":
+		return ParityNone, nil
+	case "even", "e":
+		return ParityEven, nil
+	case "odd", "o":
+		return ParityOdd, nil
+	}
+	return 0, fmt.Errorf("invalid parity: %s", s)
+}
+
+var standardBauds = []float64{300, 600, 1200, 2400, 4800, 9600, 14400, 19200, 38400, 57600, 115200, 230400, 460800, 921600, 1000000, 2000000}
+
+type UARTConfig struct {
+	// baud rate, detected from the shortest pulse when 0
+	Baud float64
+	// data bits, detected along with the parity when 0
+	DataBits int
+	Parity   Parity
+	// stop bits, detected when 0
+	StopBits float64
+	// inverted lines idle low
+	Inverted bool
+	// digitizing thresholds, computed from the waveform when both are 0
+	Low, High float64
+}
+
+func DefaultUARTConfig() UARTConfig {
+	return UARTConfig{DataBits: 8, Parity: ParityNone, StopBits: 1}
+}
+
+// SetFormat sets the data bits, parity and stop bits from a format such as 8N1 or 7E2, or
+// clears them to be detected when the format is AUTO.
+func (cfg *UARTConfig) SetFormat(format string) error {
+	if strings.ToUpper(format) == "AUTO" {
+		cfg.DataBits, cfg.Parity, cfg.StopBits = 0, ParityNone, 0
+		return nil
+	}
+	var bits, stop int
+	var parity string
+	if n, err := fmt.Sscanf(strings.ToUpper(format), "%1d%1s%1d", &bits, &parity, &stop); err != nil || n != 3 || bits < 5 || bits > 9 || stop < 1 || stop > 2 {
+		return fmt.Errorf("invalid uart format: %s", format)
+	}
+	p, err := ParseParity(parity)
+	if err != nil {
+		return fmt.Errorf("invalid uart format: %s", format)
+	}
+	cfg.DataBits, cfg.Parity, cfg.StopBits = bits, p, float64(stop)
+	return nil
+}
+
+// Format returns the data bits, parity and stop bits, such as 8N1.
+func (cfg UARTConfig) Format() string {
+	return fmt.Sprintf("%d%s%g", cfg.DataBits, []string{"N", "E", "O"}[cfg.Parity], cfg.StopBits)
+}
+
+// uartFormats are the candidate data bits and parity, the earlier preferred when they decode as well
+var uartFormats = []struct {
+	dataBits int
+	parity   Parity
+}{{8, ParityNone}, {8, ParityEven}, {8, ParityOdd}, {7, ParityEven}, {7, ParityOdd}, {7, ParityNone}, {9, ParityNone}}
+
+// a parity candidate only wins over the format without parity it decodes as well with enough bytes,
+// random data passing the parity check of every byte by chance
+const minParityBytes = 8
+
+// UART decodes the bytes of a serial line, and returns them along with the configuration used,
+// which holds the detected baud rate, data bits, parity and stop bits.
+func UART(w *waveform.Waveform, cfg UARTConfig) ([]Event, UARTConfig, error) {
+	d, err := Digitize(w, cfg.Low, cfg.High)
+	if err != nil {
+		return nil, cfg, err
+	}
+	if cfg.Inverted {
+		for i := range d.Levels {
+			d.Levels[i] = !d.Levels[i]
+		}
+	}
+	if cfg.Baud == 0 {
+		cfg.Baud, err = DetectBaud(d)
+		if err != nil {
+			return nil, cfg, err
+		}
+	}
+	if 1/cfg.Baud < 2*d.Interval {
+		return nil, cfg, fmt.Errorf("%v bauds is too fast for a %v sample interval", cfg.Baud, d.Interval)
+	}
+	stopBits := cfg.StopBits
+	if stopBits == 0 {
+		cfg.StopBits = 1
+	}
+	if cfg.DataBits == 0 {
+		cfg.DataBits, cfg.Parity = detectUARTFormat(d, cfg)
+	}
+	events := decodeUART(d, cfg)
+	if stopBits == 0 {
+		// the events are decoded again so that they check and span the detected stop bits
+		if cfg.StopBits = detectStopBits(events, cfg.Baud); cfg.StopBits != 1 {
+			events = decodeUART(d, cfg)
+		}
+	}
+	return events, cfg, nil
+}
+
+// detectUARTFormat returns the candidate data bits and parity decoding the line with the lowest
+// share of parity and framing errors
+func detectUARTFormat(d *Digital, cfg UARTConfig) (int, Parity) {
+	bestBits, bestParity, bestScore := 8, ParityNone, math.Inf(1)
+	for _, f := range uartFormats {
+		cfg.DataBits, cfg.Parity = f.dataBits, f.parity
+		events := decodeUART(d, cfg)
+		if len(events) == 0 {
+			continue
+		}
+		failed := 0
+		for _, e := range events {
+			if e.Error != "" {
+				failed++
+			}
+		}
+		score := float64(failed) / float64(len(events))
+		better := score < bestScore
+		if score == bestScore && f.parity != ParityNone && bestParity == ParityNone && f.dataBits+1 == bestBits {
+			better = len(events) >= minParityBytes
+		}
+		if better {
+			bestBits, bestParity, bestScore = f.dataBits, f.parity, score
+		}
+	}
+	return bestBits, bestParity
+}
+
+// detectStopBits returns 2 when back to back bytes are separated by a second stop bit, and 1 otherwise,
+// as a single stop bit followed by an idle line looks the same as two stop bits
+func detectStopBits(events []Event, baud float64) float64 {
+	bit := 1 / baud
+	gap := math.Inf(1)
+	for i := 1; i < len(events); i++ {
+		if events[i-1].Error == "" && events[i].Error == "" {
+			gap = math.Min(gap, events[i].Start-events[i-1].End)
+		}
+	}
+	if gap >= 0.5*bit && gap < 1.5*bit {
+		return 2
+	}
+	return 1
+}
+
+// decodeUART decodes the bytes of the digitized line with a known format and baud rate
+func decodeUART(d *Digital, cfg UARTConfig) []Event {
+	bit := 1 / cfg.Baud
+	parityBits := 0
+	if cfg.Parity != ParityNone {
+		parityBits = 1
+	}
+	events := []Event{}
+	for i := d.NextEdge(0, false); i >= 0; {
+		t0 := d.Time(i) - d.Interval/2
+		sample := func(n float64) (bool, bool) {
+			return d.At(t0 + (n+0.5)*bit)
+		}
+		if start, ok := sample(0); !ok || start {
+			// glitch or truncated start bit
+			i = d.NextEdge(i+1, false)
+			continue
+		}
+		value, ones, ok := 0, 0, true
+		for b := 0; b < cfg.DataBits && ok; b++ {
+			var level bool
+			level, ok = sample(float64(1 + b))
+			if level {
+				value |= 1 << b
+				ones++
+			}
+		}
+		frameBits := float64(1 + cfg.DataBits + parityBits)
+		stop, stopOk := sample(frameBits)
+		if !ok || !stopOk {
+			break
+		}
+		e := Event{Start: t0, End: t0 + (frameBits+cfg.StopBits)*bit, Kind: "byte", Value: value, Text: byteText(value)}
+		if parityBits > 0 {
+			p, _ := sample(float64(1 + cfg.DataBits))
+			if p {
+				ones++
+			}
+			if (cfg.Parity == ParityEven) != (ones%2 == 0) {
+				e.Error = "parity error"
+			}
+		}
+		if !stop {
+			e.Error = "framing error"
+		}
+		if cfg.StopBits >= 2 {
+			if stop2, ok := sample(frameBits + 1); ok && !stop2 {
+				e.Error = "framing error"
+			}
+		}
+		events = append(events, e)
+		next, _ := d.Index(t0 + (frameBits+0.5)*bit)
+		i = d.NextEdge(next, false)
+	}
+	return events
+}
+
+// DetectBaud estimates the baud rate from the shortest complete pulse, snapped to a standard rate when close.
+func DetectBaud(d *Digital) (float64, error) {
+	edges := d.Edges()
+	if len(edges) < 2 {
+		return 0, fmt.Errorf("not enough transitions to detect the baud rate")
+	}
+	shortest := math.MaxInt
+	for i := 1; i < len(edges); i++ {
+		if edges[i]-edges[i-1] < shortest {
+			shortest = edges[i] - edges[i-1]
+		}
+	}
+	baud := 1 / (float64(shortest) * d.Interval)
+	for _, sb := range standardBauds {
+		if math.Abs(baud-sb)/sb < 0.08 {
+			return sb, nil
+		}
+	}
+	return baud, nil
+}
+
+func byteText(v int) string {
+	if v >= 0x20 && v < 0x7f {
+		return fmt.Sprintf("0x%02X '%c'", v, v)
+	}
+	return fmt.Sprintf("0x%02X", v)
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package decode
+
+import (
+	"fmt"
+	"github.com/frnckdlprt/hdsctl/waveform"
+)
+
+// WS2812 bits are encoded by the width of the high pulse, the line idles low
+var ws2812Classes = []PulseClass{
+	{Name: "0", Level: true, Min: 0.15e-6, Max: 0.6e-6},
+	{Name: "1", Level: true, Min: 0.6e-6, Max: 1.1e-6},
+	{Name: "reset", Level: false, Min: 50e-6},
+	{Name: "gap", Level: false, Max: 50e-6},
+}
+
+// WS2812 decodes the colors sent to a chain of WS2812 LEDs, as GRB triplets. The value of an event
+// is the color as 0xRRGGBB, and its text the index of the LED in the chain along with the color.
+func WS2812(w *waveform.Waveform, low, high float64) ([]Event, error) {
+	pulses, err := ClassifyPulses(w, low, high, ws2812Classes)
+	if err != nil {
+		return nil, err
+	}
+	events := []Event{}
+	var bits []bool
+	var start float64
+	led := 0
+	incomplete := func(end float64) {
+		if len(bits) > 0 {
+			events = append(events, Event{Start: start, End: end, Kind: "error", Text: fmt.Sprintf("%v bits", len(bits)), Error: "incomplete color"})
+		}
+		bits = nil
+	}
+	for _, p := range pulses {
+		switch p.Class {
+		case "0", "1":
+			if len(bits) == 0 {
+				start = p.Start
+			}
+			bits = append(bits, p.Class == "1")
+			if len(bits) < 24 {
+				continue
+			}
+			g, r, b := bitsValue(bits[:8]), bitsValue(bits[8:16]), bitsValue(bits[16:])
+			rgb := r<<16 | g<<8 | b
+			events = append(events, Event{Start: start, End: p.End, Kind: "led", Value: rgb, Text: fmt.Sprintf("%v #%06X", led, rgb)})
+			bits = nil
+			led++
+		case "reset":
+			incomplete(p.Start)
+			events = append(events, Event{Start: p.Start, End: p.End, Kind: "reset", Text: "RESET"})
+			led = 0
+		case "gap":
+		default:
+			incomplete(p.Start)
+			events = append(events, Event{Start: p.Start, End: p.End, Kind: "error", Text: fmt.Sprintf("%.2fus high", p.Width()*1e6), Error: "invalid bit"})
+		}
+	}
+	return events, nil
+}
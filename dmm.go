@@ -0,0 +1,263 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hdsctl
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DMMMode is a measurement function of the multimeter
+type DMMMode string
+
+const (
+	VoltsDC     DMMMode = "DCV"
+	VoltsAC     DMMMode = "ACV"
+	CurrentDC   DMMMode = "DCA"
+	CurrentAC   DMMMode = "ACA"
+	Resistance  DMMMode = "R"
+	Continuity  DMMMode = "CONT"
+	Diode       DMMMode = "DIODE"
+	Capacitance DMMMode = "C"
+)
+
+// DMMModes lists the measurement functions, in the order of the scope menu
+var DMMModes = []DMMMode{VoltsDC, VoltsAC, CurrentDC, CurrentAC, Resistance, Continuity, Diode, Capacitance}
+
+var dmmModeCommands = map[DMMMode]string{
+	VoltsDC:     ":DMM:CONFigure:VOLTage DC",
+	VoltsAC:     ":DMM:CONFigure:VOLTage AC",
+	CurrentDC:   ":DMM:CONFigure:CURRent DC",
+	CurrentAC:   ":DMM:CONFigure:CURRent AC",
+	Resistance:  ":DMM:CONFigure R",
+	Continuity:  ":DMM:CONFigure RS",
+	Diode:       ":DMM:CONFigure DIODE",
+	Capacitance: ":DMM:CONFigure C",
+}
+
+var dmmModeUnits = map[DMMMode]string{
+	VoltsDC:     "V",
+	VoltsAC:     "V",
+	CurrentDC:   "A",
+	CurrentAC:   "A",
+	Resistance:  "Ω",
+	Continuity:  "Ω",
+	Diode:       "V",
+	Capacitance: "F",
+}
+
+func ParseDMMMode(s string) (DMMMode, error) {
+	for _, m := range DMMModes {
+		if strings.EqualFold(s, string(m)) {
+			return m, nil
+		}
+	}
+	return "", fmt.Errorf("invalid dmm mode: %s", s)
+}
+
+// Unit returns the base unit of the readings of the mode
+func (m DMMMode) Unit() string {
+	return dmmModeUnits[m]
+}
+
+// Reading is a parsed multimeter measurement, Value is in base units and is NaN on overload
+type Reading struct {
+	Time     time.Time
+	Value    float64
+	Unit     string
+	Overload bool
+	Raw      string
+}
+
+func (r Reading) String() string {
+	if r.Overload {
+		return fmt.Sprintf("OL %s", r.Unit)
+	}
+	return FormatValue(r.Value, r.Unit)
+}
+
+// ParseReading parses a :DMM:MEAS answer such as "1.234mV", "12.5kΩ" or "OL", the unit
+// defaults to the one of the mode when the answer has none
+func ParseReading(s string, mode DMMMode) (Reading, error) {
+	r := Reading{Raw: strings.TrimSpace(s), Unit: mode.Unit()}
+	if strings.Contains(strings.ToUpper(r.Raw), "OL") {
+		r.Overload = true
+		r.Value = math.NaN()
+		return r, nil
+	}
+	v, unit, err := ParseValue(r.Raw)
+	if err != nil {
+		return r, fmt.Errorf("invalid dmm reading: %s", s)
+	}
+	r.Value = v
+	if unit != "" {
+		r.Unit = unit
+	}
+	return r, nil
+}
+
+// DMMStats holds the minimum, maximum and average of the readings, overloads excluded
+type DMMStats struct {
+	Count int
+	Min   float64
+	Max   float64
+	Sum   float64
+	Unit  string
+}
+
+func (s *DMMStats) Add(r Reading) {
+	if r.Overload {
+		return
+	}
+	// a unit change, such as the mode being changed on the scope, restarts the statistics
+	if s.Count == 0 || r.Unit != s.Unit {
+		*s = DMMStats{Min: r.Value, Max: r.Value, Unit: r.Unit}
+	}
+	s.Count++
+	s.Sum += r.Value
+	s.Min = math.Min(s.Min, r.Value)
+	s.Max = math.Max(s.Max, r.Value)
+}
+
+func (s DMMStats) Avg() float64 {
+	if s.Count == 0 {
+		return math.NaN()
+	}
+	return s.Sum / float64(s.Count)
+}
+
+func (s DMMStats) String() string {
+	if s.Count == 0 {
+		return "no reading"
+	}
+	return fmt.Sprintf("min=%s max=%s avg=%s n=%d", FormatValue(s.Min, s.Unit), FormatValue(s.Max, s.Unit), FormatValue(s.Avg(), s.Unit), s.Count)
+}
+
+// DMM drives the multimeter of the scope and keeps statistics of its readings
+type DMM struct {
+	hds   *HDS
+	mx    sync.Mutex
+	mode  DMMMode
+	stats DMMStats
+}
+
+func NewDMM(hds *HDS) *DMM {
+	return &DMM{hds: hds}
+}
+
+// SetMode selects the measurement function, and resets the statistics
+func (d *DMM) SetMode(mode DMMMode) error {
+	cmd, ok := dmmModeCommands[mode]
+	if !ok {
+		return fmt.Errorf("invalid dmm mode: %s", mode)
+	}
+	if err := d.hds.Client.Set(cmd); err != nil {
+		return fmt.Errorf("failed to set dmm mode %s: %w", mode, err)
+	}
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	d.mode = mode
+	d.stats = DMMStats{}
+	return nil
+}
+
+// Mode returns the mode last set, empty when it was never set
+func (d *DMM) Mode() DMMMode {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	return d.mode
+}
+
+// SetRange selects a manual range, the scope only offers mV and V for the voltage modes
+func (d *DMM) SetRange(r string) error {
+	mode := d.Mode()
+	if mode != VoltsDC && mode != VoltsAC {
+		return fmt.Errorf("no manual range in dmm mode %s", mode)
+	}
+	if r != "mV" && r != "V" {
+		return fmt.Errorf("invalid dmm range: %s", r)
+	}
+	if err := d.hds.Client.Set(":DMM:RANGE " + r); err != nil {
+		return fmt.Errorf("failed to set dmm range %s: %w", r, err)
+	}
+	return nil
+}
+
+// Auto selects the range automatically
+func (d *DMM) Auto() error {
+	if err := d.hds.Client.Set(":DMM:AUTO ON"); err != nil {
+		return fmt.Errorf("failed to set dmm auto range: %w", err)
+	}
+	return nil
+}
+
+// SetRelative turns the relative mode on or off, the scope then measures relative to the
+// value read when it was turned on. The statistics are reset.
+func (d *DMM) SetRelative(on bool) error {
+	v := "OFF"
+	if on {
+		v = "ON"
+	}
+	if err := d.hds.Client.Set(":DMM:REL " + v); err != nil {
+		return fmt.Errorf("failed to set dmm relative mode: %w", err)
+	}
+	d.ResetStats()
+	return nil
+}
+
+func (d *DMM) Relative() (bool, error) {
+	v, err := d.hds.Client.GetString(":DMM:REL?")
+	if err != nil {
+		return false, fmt.Errorf("failed to get dmm relative mode: %w", err)
+	}
+	return strings.EqualFold(v, "ON"), nil
+}
+
+// Read returns the current measurement, and adds it to the statistics
+func (d *DMM) Read() (Reading, error) {
+	s, err := d.hds.Client.GetString(":DMM:MEAS?")
+	if err != nil {
+		return Reading{}, fmt.Errorf("failed to read dmm: %w", err)
+	}
+	if s == "" {
+		return Reading{}, fmt.Errorf("failed to read dmm: empty answer")
+	}
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	r, err := ParseReading(s, d.mode)
+	if err != nil {
+		return r, err
+	}
+	r.Time = time.Now()
+	d.stats.Add(r)
+	return r, nil
+}
+
+func (d *DMM) Stats() DMMStats {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	return d.stats
+}
+
+func (d *DMM) ResetStats() {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	d.stats = DMMStats{}
+}
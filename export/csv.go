@@ -0,0 +1,108 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/frnckdlprt/hdsctl"
+	"github.com/frnckdlprt/hdsctl/waveform"
+	"io"
+	"strconv"
+	"time"
+)
+
+// WriteCSV writes the frame as a time column followed by one volts column per channel, and one
+// column per extra waveform such as math channels, preceded by a commented metadata block.
+// Use '\t' as comma for TSV.
+func WriteCSV(w io.Writer, frame *hdsctl.Frame, comma rune, extra ...*waveform.Waveform) error {
+	header := frame.Header
+	fmt.Fprintf(w, "# idn: %s %s\n", header.IDN, header.Model)
+	fmt.Fprintf(w, "# timestamp: %s\n", frame.Timestamp.Format(time.RFC3339Nano))
+	fmt.Fprintf(w, "# time scale: %s/div, offset: %v div\n", header.TimeBase.Scale, header.TimeBase.HOffset)
+	fmt.Fprintf(w, "# sample rate: %s\n", header.Sample.SampleRate)
+	channels := frame.Channels()
+	columns := [][]float64{}
+	names := []string{"time_s"}
+	for _, ch := range channels {
+		hc, _ := header.Channel(ch)
+		fmt.Fprintf(w, "# %s scale: %s/div, offset: %v, probe: %s, coupling: %s\n", hc.Name, hc.Scale, hc.Offset, hc.Probe, hc.Coupling)
+		volts, err := frame.Volts(ch)
+		if err != nil {
+			return err
+		}
+		columns = append(columns, volts)
+		names = append(names, fmt.Sprintf("%s_V", hc.Name))
+	}
+	for _, e := range extra {
+		if len(e.Samples) < samples(frame) {
+			return fmt.Errorf("%s is shorter than the frame", e.Name)
+		}
+		columns = append(columns, e.Samples)
+		names = append(names, fmt.Sprintf("%s_%s", e.Name, e.Unit))
+	}
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	cw.Write(names)
+	for i := 0; i < samples(frame); i++ {
+		t, err := header.Time(i)
+		if err != nil {
+			return err
+		}
+		row := []string{strconv.FormatFloat(t, 'g', -1, 64)}
+		for _, c := range columns {
+			row = append(row, strconv.FormatFloat(c[i], 'g', -1, 64))
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Extra returns additional waveforms of a frame, such as math channels, exported after its channels
+type Extra func(frame *hdsctl.Frame) ([]*waveform.Waveform, error)
+
+// extraWaveforms returns the extra waveforms of the frame, none when extra is nil, at least n samples long
+func extraWaveforms(extra Extra, frame *hdsctl.Frame, n int) ([]*waveform.Waveform, error) {
+	if extra == nil {
+		return nil, nil
+	}
+	ws, err := extra(frame)
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range ws {
+		if len(w.Samples) < n {
+			return nil, fmt.Errorf("%s is shorter than the frame", w.Name)
+		}
+	}
+	return ws, nil
+}
+
+// samples returns the shortest wave length of the frame
+func samples(frame *hdsctl.Frame) int {
+	n := -1
+	for _, wav := range frame.Waves {
+		if n < 0 || len(wav) < n {
+			n = len(wav)
+		}
+	}
+	if n < 0 {
+		return 0
+	}
+	return n
+}
@@ -0,0 +1,187 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/frnckdlprt/hdsctl"
+	"github.com/frnckdlprt/hdsctl/waveform"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testFrame() *hdsctl.Frame {
+	header := &hdsctl.Header{
+		TimeBase: hdsctl.HeaderTimeBase{Scale: "1.0ms"},
+		Sample:   hdsctl.HeaderSample{FullScreen: 4, DataLen: 4, SampleRate: "1kSa/s", Type: "SAMPle", DepMem: "4K"},
+		Channels: []hdsctl.HeaderChannel{
+			{Name: "CH1", Display: "ON", Probe: "10X", Scale: "1.00V", Offset: 25},
+			{Name: "CH2", Display: "ON", Probe: "1X", Scale: "500mV", Offset: 0},
+		},
+		IDN:   "owon_v1.2",
+		Model: "HDS272S_1",
+	}
+	return &hdsctl.Frame{
+		Seq:       1,
+		Timestamp: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		Header:    header,
+		Waves:     map[int][]int8{1: {25, 50, 0, 25}, 2: {0, 50, -50, 0}},
+	}
+}
+
+func assertNilErr(t *testing.T, err error) {
+	if err != nil {
+		t.Fatalf("error unexpected: %v", err)
+	}
+}
+
+func Test_csv(t *testing.T) {
+	buff := &bytes.Buffer{}
+	assertNilErr(t, WriteCSV(buff, testFrame(), '\t'))
+	lines := strings.Split(strings.TrimSpace(buff.String()), "\n")
+	expected := []string{
+		"time_s\tCH1_V\tCH2_V",
+		"-0.006\t0\t0",
+		"-0.003\t1\t1",
+		"0\t-1\t-1",
+		"0.003\t0\t0",
+	}
+	data := lines[len(lines)-len(expected):]
+	for i := range expected {
+		if data[i] != expected[i] {
+			t.Fatalf("unexpected line %v: %q != %q", i, data[i], expected[i])
+		}
+	}
+	if !strings.HasPrefix(lines[0], "# idn: owon_v1.2") {
+		t.Fatalf("unexpected metadata: %s", lines[0])
+	}
+}
+
+func Test_npz(t *testing.T) {
+	buff := &bytes.Buffer{}
+	frames := []*hdsctl.Frame{testFrame(), testFrame()}
+	assertNilErr(t, WriteNPZSeries(buff, frames, nil))
+	zr, err := zip.NewReader(bytes.NewReader(buff.Bytes()), int64(buff.Len()))
+	assertNilErr(t, err)
+	names := []string{}
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	if strings.Join(names, " ") != "time.npy CH1.npy CH2.npy seq.npy timestamp.npy metadata.json" {
+		t.Fatalf("unexpected entries: %v", names)
+	}
+	r, err := zr.File[1].Open()
+	assertNilErr(t, err)
+	b, err := io.ReadAll(r)
+	assertNilErr(t, err)
+	hl := int(binary.LittleEndian.Uint16(b[8:10]))
+	if (10+hl)%64 != 0 || !strings.Contains(string(b[10:10+hl]), "'shape': (2, 4)") {
+		t.Fatalf("unexpected npy header: %q", b[:10+hl])
+	}
+	if len(b)-10-hl != 2*4*8 || math.Float64frombits(binary.LittleEndian.Uint64(b[10+hl+8:])) != 1 {
+		t.Fatalf("unexpected npy data: %v", b[10+hl:])
+	}
+	buff.Reset()
+	assertNilErr(t, WriteNPZ(buff, testFrame(), testMath))
+	zr, err = zip.NewReader(bytes.NewReader(buff.Bytes()), int64(buff.Len()))
+	assertNilErr(t, err)
+	if len(zr.File) != 5 || zr.File[3].Name != "MATH.npy" {
+		t.Fatalf("missing math entry: %v", zr.File)
+	}
+	// the math waveform missing from a later frame
+	second := testFrame()
+	second.Seq = 2
+	err = WriteNPZSeries(&bytes.Buffer{}, []*hdsctl.Frame{testFrame(), second}, func(frame *hdsctl.Frame) ([]*waveform.Waveform, error) {
+		if frame.Seq > 1 {
+			return nil, nil
+		}
+		return testMath(frame)
+	})
+	if err == nil || !strings.Contains(err.Error(), "extra waveforms") {
+		t.Fatalf("expected mismatching extra waveforms: %v", err)
+	}
+}
+
+func testMath(frame *hdsctl.Frame) ([]*waveform.Waveform, error) {
+	return []*waveform.Waveform{{Name: "MATH", Unit: "V", Samples: []float64{1, 2, 3, 4}}}, nil
+}
+
+func Test_sigrok(t *testing.T) {
+	buff := &bytes.Buffer{}
+	assertNilErr(t, WriteSigrok(buff, testFrame(), []DigitalChannel{{Name: "D0", Channel: 1, Threshold: 0.5}}, nil))
+	zr, err := zip.NewReader(bytes.NewReader(buff.Bytes()), int64(buff.Len()))
+	assertNilErr(t, err)
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		r, err := f.Open()
+		assertNilErr(t, err)
+		files[f.Name], err = io.ReadAll(r)
+		assertNilErr(t, err)
+	}
+	metadata := string(files["metadata"])
+	for _, s := range []string{"probe1=D0", "analog2=CH1", "analog3=CH2", "samplerate=1 kHz", "total analog=2"} {
+		if !strings.Contains(metadata, s) {
+			t.Fatalf("missing %s in metadata: %s", s, metadata)
+		}
+	}
+	if fmt.Sprint(files["logic-1-1"]) != "[0 1 0 0]" || len(files["analog-1-3-1"]) != 16 {
+		t.Fatalf("unexpected data: %v %v", files["logic-1-1"], files["analog-1-3-1"])
+	}
+	buff.Reset()
+	assertNilErr(t, WriteSigrok(buff, testFrame(), nil, testMath))
+	if !bytes.Contains(buff.Bytes(), []byte("analog-1-3-1")) {
+		t.Fatalf("missing math channel")
+	}
+}
+
+func Test_wav(t *testing.T) {
+	buff := &bytes.Buffer{}
+	assertNilErr(t, WriteWAV(buff, []*hdsctl.Frame{testFrame(), testFrame()}, true, nil))
+	b := buff.Bytes()
+	if string(b[:4]) != "RIFF" || string(b[8:16]) != "WAVEfmt " || string(b[36:40]) != "data" {
+		t.Fatalf("unexpected wav header: %q", b[:44])
+	}
+	if binary.LittleEndian.Uint16(b[22:]) != 2 || binary.LittleEndian.Uint32(b[24:]) != 1000 {
+		t.Fatalf("unexpected channels or sample rate: %v", b[22:28])
+	}
+	if binary.LittleEndian.Uint32(b[40:]) != 2*4*2*2 || int16(binary.LittleEndian.Uint16(b[48:])) != math.MaxInt16 {
+		t.Fatalf("unexpected wav data: %v", b[40:])
+	}
+	buff.Reset()
+	assertNilErr(t, WriteWAV(buff, []*hdsctl.Frame{testFrame()}, false, nil))
+	b = buff.Bytes()
+	if binary.LittleEndian.Uint32(b[16:]) != 40 || binary.LittleEndian.Uint16(b[20:]) != 0xFFFE || binary.LittleEndian.Uint16(b[36:]) != 22 {
+		t.Fatalf("unexpected extensible header: %v", b[16:60])
+	}
+	if string(b[60:64]) != "fact" || binary.LittleEndian.Uint32(b[68:]) != 4 || string(b[72:76]) != "data" {
+		t.Fatalf("unexpected wav chunks: %q", b[60:80])
+	}
+	if int(binary.LittleEndian.Uint32(b[4:])) != len(b)-8 || binary.LittleEndian.Uint32(b[76:]) != 2*4*4 {
+		t.Fatalf("unexpected wav sizes: %v %v", b[4:8], b[76:80])
+	}
+	buff.Reset()
+	assertNilErr(t, WriteWAV(buff, []*hdsctl.Frame{testFrame()}, true, testMath))
+	if binary.LittleEndian.Uint16(buff.Bytes()[22:]) != 3 {
+		t.Fatalf("unexpected channels with math: %v", buff.Bytes()[22:24])
+	}
+}
@@ -0,0 +1,174 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/frnckdlprt/hdsctl"
+	"io"
+	"strings"
+	"time"
+)
+
+type frameMetadata struct {
+	Seq       uint64         `json:"seq"`
+	Timestamp time.Time      `json:"timestamp"`
+	Header    *hdsctl.Header `json:"header"`
+}
+
+// WriteNPZ writes the frame as a numpy archive holding a float64 "time" array, one float64
+// array per channel in volts and per extra waveform, and a "metadata.json" entry made from
+// the frame header. extra may be nil.
+func WriteNPZ(w io.Writer, frame *hdsctl.Frame, extra Extra) error {
+	return writeNPZ(w, []*hdsctl.Frame{frame}, false, extra)
+}
+
+// WriteNPZSeries writes successive frames as a numpy archive of 2D arrays, one row per frame,
+// along with the "seq" and "timestamp" (unix seconds) arrays.
+func WriteNPZSeries(w io.Writer, frames []*hdsctl.Frame, extra Extra) error {
+	return writeNPZ(w, frames, true, extra)
+}
+
+func writeNPZ(w io.Writer, frames []*hdsctl.Frame, series bool, extra Extra) error {
+	if len(frames) == 0 {
+		return fmt.Errorf("no frame to export")
+	}
+	channels := frames[0].Channels()
+	n := samples(frames[0])
+	arrays := map[string][]float64{}
+	seqs := []uint64{}
+	timestamps := []float64{}
+	metadata := []frameMetadata{}
+	names := channelNames(frames[0])
+	for f, frame := range frames {
+		if fmt.Sprint(frame.Channels()) != fmt.Sprint(channels) || samples(frame) != n {
+			return fmt.Errorf("frame %v does not match the channels or length of the first frame", frame.Seq)
+		}
+		for i := 0; i < n; i++ {
+			t, err := frame.Header.Time(i)
+			if err != nil {
+				return err
+			}
+			arrays["time"] = append(arrays["time"], t)
+		}
+		for _, ch := range channels {
+			volts, err := frame.Volts(ch)
+			if err != nil {
+				return err
+			}
+			name := frame.Header.Channels[ch-1].Name
+			arrays[name] = append(arrays[name], volts[:n]...)
+		}
+		ws, err := extraWaveforms(extra, frame, n)
+		if err != nil {
+			return err
+		}
+		if f > 0 && len(ws) != len(names)-len(channels) {
+			return fmt.Errorf("frame %v does not match the extra waveforms of the first frame", frame.Seq)
+		}
+		for i, e := range ws {
+			if f == 0 {
+				names = append(names, e.Name)
+			} else if names[len(channels)+i] != e.Name {
+				return fmt.Errorf("frame %v does not match the extra waveforms of the first frame", frame.Seq)
+			}
+			arrays[e.Name] = append(arrays[e.Name], e.Samples[:n]...)
+		}
+		seqs = append(seqs, frame.Seq)
+		timestamps = append(timestamps, float64(frame.Timestamp.UnixNano())/1e9)
+		metadata = append(metadata, frameMetadata{Seq: frame.Seq, Timestamp: frame.Timestamp, Header: frame.Header})
+	}
+	shape := []int{n}
+	if series {
+		shape = []int{len(frames), n}
+	}
+	zw := zip.NewWriter(w)
+	for _, name := range append([]string{"time"}, names...) {
+		if err := writeZipNPY(zw, name, "<f8", shape, arrays[name]); err != nil {
+			return err
+		}
+	}
+	var meta interface{} = metadata[0]
+	if series {
+		if err := writeZipNPY(zw, "seq", "<u8", []int{len(frames)}, seqs); err != nil {
+			return err
+		}
+		if err := writeZipNPY(zw, "timestamp", "<f8", []int{len(frames)}, timestamps); err != nil {
+			return err
+		}
+		meta = metadata
+	}
+	mw, err := zw.Create("metadata.json")
+	if err != nil {
+		return fmt.Errorf("failed to create metadata: %w", err)
+	}
+	if err := json.NewEncoder(mw).Encode(meta); err != nil {
+		return fmt.Errorf("failed to write metadata: %w", err)
+	}
+	return zw.Close()
+}
+
+func channelNames(frame *hdsctl.Frame) []string {
+	result := []string{}
+	for _, ch := range frame.Channels() {
+		result = append(result, frame.Header.Channels[ch-1].Name)
+	}
+	return result
+}
+
+func writeZipNPY(zw *zip.Writer, name, descr string, shape []int, data interface{}) error {
+	fw, err := zw.Create(name + ".npy")
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", name, err)
+	}
+	if err := WriteNPY(fw, descr, shape, data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// WriteNPY writes data, a slice of fixed size numbers matching descr, in the numpy .npy v1.0 format.
+func WriteNPY(w io.Writer, descr string, shape []int, data interface{}) error {
+	dims := []string{}
+	for _, d := range shape {
+		dims = append(dims, fmt.Sprint(d))
+	}
+	sh := strings.Join(dims, ", ")
+	if len(shape) == 1 {
+		sh += ","
+	}
+	header := fmt.Sprintf("{'descr': '%s', 'fortran_order': False, 'shape': (%s), }", descr, sh)
+	// magic, version and header length take 10 bytes, the whole header is padded to 64 bytes
+	pad := 64 - (10+len(header)+1)%64
+	if pad == 64 {
+		pad = 0
+	}
+	header += strings.Repeat(" ", pad) + "\n"
+	buff := &bytes.Buffer{}
+	buff.WriteString("\x93NUMPY\x01\x00")
+	binary.Write(buff, binary.LittleEndian, uint16(len(header)))
+	buff.WriteString(header)
+	if err := binary.Write(buff, binary.LittleEndian, data); err != nil {
+		return err
+	}
+	_, err := w.Write(buff.Bytes())
+	return err
+}
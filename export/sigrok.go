@@ -0,0 +1,133 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/frnckdlprt/hdsctl"
+	"io"
+	"math"
+	"strconv"
+)
+
+// DigitalChannel is a logic channel made by thresholding an analog channel
+type DigitalChannel struct {
+	Name      string
+	Channel   int
+	Threshold float64
+}
+
+// WriteSigrok writes the frame as a sigrok v2 session (.sr) with one analog channel per displayed
+// channel and per extra waveform, plus the given digital channels, at the header sample rate.
+// extra may be nil.
+func WriteSigrok(w io.Writer, frame *hdsctl.Frame, digital []DigitalChannel, extra Extra) error {
+	rate, err := frame.Header.SampleRate()
+	if err != nil {
+		return err
+	}
+	n := samples(frame)
+	zw := zip.NewWriter(w)
+	if err := writeZipFile(zw, "version", []byte("2")); err != nil {
+		return err
+	}
+	metadata := &bytes.Buffer{}
+	fmt.Fprintf(metadata, "[global]\nsigrok version=0.5.2\n\n[device 1]\n")
+	if len(digital) > 0 {
+		unitsize := (len(digital) + 7) / 8
+		logic := make([]byte, n*unitsize)
+		for i, dc := range digital {
+			volts, err := frame.Volts(dc.Channel)
+			if err != nil {
+				return fmt.Errorf("failed to threshold %s: %w", dc.Name, err)
+			}
+			for j := 0; j < n; j++ {
+				if volts[j] >= dc.Threshold {
+					logic[j*unitsize+i/8] |= 1 << (i % 8)
+				}
+			}
+			fmt.Fprintf(metadata, "probe%v=%s\n", i+1, dc.Name)
+		}
+		fmt.Fprintf(metadata, "capturefile=logic-1\nunitsize=%v\n", unitsize)
+		if err := writeZipFile(zw, "logic-1-1", logic); err != nil {
+			return err
+		}
+	}
+	names, analog := []string{}, [][]float64{}
+	for _, ch := range frame.Channels() {
+		volts, err := frame.Volts(ch)
+		if err != nil {
+			return err
+		}
+		names = append(names, frame.Header.Channels[ch-1].Name)
+		analog = append(analog, volts)
+	}
+	ws, err := extraWaveforms(extra, frame, n)
+	if err != nil {
+		return err
+	}
+	for _, e := range ws {
+		names = append(names, e.Name)
+		analog = append(analog, e.Samples)
+	}
+	fmt.Fprintf(metadata, "total probes=%v\ntotal analog=%v\n", len(digital), len(analog))
+	fmt.Fprintf(metadata, "samplerate=%s\n", samplerateString(rate))
+	for i, volts := range analog {
+		// analog channels are numbered after the logic ones
+		index := len(digital) + i + 1
+		fmt.Fprintf(metadata, "analog%v=%s\n", index, names[i])
+		data := make([]float32, n)
+		for j := range data {
+			data[j] = float32(volts[j])
+		}
+		buff := &bytes.Buffer{}
+		binary.Write(buff, binary.LittleEndian, data)
+		if err := writeZipFile(zw, fmt.Sprintf("analog-1-%v-1", index), buff.Bytes()); err != nil {
+			return err
+		}
+	}
+	if err := writeZipFile(zw, "metadata", metadata.Bytes()); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func writeZipFile(zw *zip.Writer, name string, data []byte) error {
+	fw, err := zw.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", name, err)
+	}
+	if _, err := fw.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// samplerateString formats a sample rate the way sigrok does, such as "250 kHz"
+func samplerateString(rate float64) string {
+	for _, u := range []struct {
+		unit  string
+		value float64
+	}{{"GHz", 1e9}, {"MHz", 1e6}, {"kHz", 1e3}} {
+		if rate >= u.value {
+			return strconv.FormatFloat(math.Round(rate/u.value*1e6)/1e6, 'f', -1, 64) + " " + u.unit
+		}
+	}
+	return strconv.FormatFloat(math.Round(rate*1e6)/1e6, 'f', -1, 64) + " Hz"
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/frnckdlprt/hdsctl"
+	"io"
+	"math"
+)
+
+const (
+	wavFormatPCM        = 1
+	wavFormatExtensible = 0xFFFE
+)
+
+// KSDATAFORMAT_SUBTYPE_IEEE_FLOAT, the sub format of the extensible header for 32 bits floats
+var wavSubFormatFloat = []byte{3, 0, 0, 0, 0, 0, 0x10, 0, 0x80, 0, 0, 0xaa, 0, 0x38, 0x9b, 0x71}
+
+// WriteWAV writes successive frames concatenated as a WAV file with one audio channel per
+// displayed channel (CH1 left, CH2 right), followed by one per extra waveform, at the header sample
+// rate. When normalize is set, the samples are scaled to the peak value as 16 bits PCM, otherwise
+// they are written in volts as 32 bits floats with an extensible format header. extra may be nil.
+func WriteWAV(w io.Writer, frames []*hdsctl.Frame, normalize bool, extra Extra) error {
+	if len(frames) == 0 {
+		return fmt.Errorf("no frame to export")
+	}
+	channels := frames[0].Channels()
+	if len(channels) == 0 {
+		return fmt.Errorf("no channel to export")
+	}
+	sampleRate, err := frames[0].Header.SampleRate()
+	if err != nil {
+		return err
+	}
+	rate := uint32(math.Round(sampleRate))
+	if rate == 0 {
+		return fmt.Errorf("sample rate too low: %v", sampleRate)
+	}
+	interleaved := []float64{}
+	peak := 0.0
+	width := 0
+	for _, frame := range frames {
+		if fmt.Sprint(frame.Channels()) != fmt.Sprint(channels) || frame.Header.Sample.SampleRate != frames[0].Header.Sample.SampleRate {
+			return fmt.Errorf("frame %v does not match the channels or sample rate of the first frame", frame.Seq)
+		}
+		volts := [][]float64{}
+		for _, ch := range channels {
+			v, err := frame.Volts(ch)
+			if err != nil {
+				return err
+			}
+			volts = append(volts, v)
+		}
+		ws, err := extraWaveforms(extra, frame, samples(frame))
+		if err != nil {
+			return err
+		}
+		for _, e := range ws {
+			volts = append(volts, e.Samples)
+		}
+		if width == 0 {
+			width = len(volts)
+		} else if len(volts) != width {
+			return fmt.Errorf("frame %v does not match the extra waveforms of the first frame", frame.Seq)
+		}
+		for i := 0; i < samples(frame); i++ {
+			for _, v := range volts {
+				interleaved = append(interleaved, v[i])
+				peak = math.Max(peak, math.Abs(v[i]))
+			}
+		}
+	}
+	var data interface{}
+	bits := uint16(32)
+	if normalize {
+		bits = 16
+		if peak == 0 {
+			peak = 1
+		}
+		pcm := make([]int16, len(interleaved))
+		for i, v := range interleaved {
+			pcm[i] = int16(math.Round(v / peak * math.MaxInt16))
+		}
+		data = pcm
+	} else {
+		float := make([]float32, len(interleaved))
+		for i, v := range interleaved {
+			float[i] = float32(v)
+		}
+		data = float
+	}
+	nch := uint16(width)
+	blockAlign := nch * bits / 8
+	dataLen := uint32(len(interleaved)) * uint32(bits/8)
+	fmtChunk := &bytes.Buffer{}
+	if normalize {
+		for _, v := range []interface{}{uint16(wavFormatPCM), nch, rate, rate * uint32(blockAlign), blockAlign, bits} {
+			binary.Write(fmtChunk, binary.LittleEndian, v)
+		}
+	} else {
+		// cbSize, valid bits, channel mask (front left, front right) and sub format
+		mask := uint32(1<<nch - 1)
+		for _, v := range []interface{}{uint16(wavFormatExtensible), nch, rate, rate * uint32(blockAlign), blockAlign, bits,
+			uint16(22), bits, mask, wavSubFormatFloat} {
+			binary.Write(fmtChunk, binary.LittleEndian, v)
+		}
+	}
+	buff := &bytes.Buffer{}
+	buff.WriteString("RIFF")
+	riffLen := 4 + 8 + fmtChunk.Len() + 8 + int(dataLen)
+	if !normalize {
+		riffLen += 12
+	}
+	binary.Write(buff, binary.LittleEndian, uint32(riffLen))
+	buff.WriteString("WAVEfmt ")
+	binary.Write(buff, binary.LittleEndian, uint32(fmtChunk.Len()))
+	buff.Write(fmtChunk.Bytes())
+	if !normalize {
+		// non PCM formats carry the number of samples per channel in a fact chunk
+		buff.WriteString("fact")
+		binary.Write(buff, binary.LittleEndian, []uint32{4, uint32(len(interleaved)) / uint32(nch)})
+	}
+	buff.WriteString("data")
+	binary.Write(buff, binary.LittleEndian, dataLen)
+	binary.Write(buff, binary.LittleEndian, data)
+	_, err = w.Write(buff.Bytes())
+	return err
+}
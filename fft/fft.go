@@ -0,0 +1,219 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fft
+
+import (
+	"fmt"
+	"github.com/frnckdlprt/hdsctl/waveform"
+	"math"
+	"math/cmplx"
+	"sort"
+	"strings"
+)
+
+type Window int
+
+const (
+	Rectangular Window = iota
+	Hann
+	Hamming
+	Blackman
+	FlatTop
+)
+
+var windowNames = []string{"rectangular", "hann", "hamming", "blackman", "flattop"}
+
+func (w Window) String() string {
+	return windowNames[w]
+}
+
+func ParseWindow(s string) (Window, error) {
+	for i, name := range windowNames {
+		if name == s {
+			return Window(i), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid window: %s", s)
+}
+
+func WindowNames() []string {
+	return windowNames
+}
+
+// coefficients returns the window of size n
+func (w Window) coefficients(n int) []float64 {
+	result := make([]float64, n)
+	for i := range result {
+		x := 2 * math.Pi * float64(i) / float64(n-1)
+		switch w {
+		case Hann:
+			result[i] = 0.5 - 0.5*math.Cos(x)
+		case Hamming:
+			result[i] = 0.54 - 0.46*math.Cos(x)
+		case Blackman:
+			result[i] = 0.42 - 0.5*math.Cos(x) + 0.08*math.Cos(2*x)
+		case FlatTop:
+			result[i] = 0.21557895 - 0.41663158*math.Cos(x) + 0.277263158*math.Cos(2*x) - 0.083578947*math.Cos(3*x) + 0.006947368*math.Cos(4*x)
+		default:
+			result[i] = 1
+		}
+	}
+	return result
+}
+
+// Spectrum is a single sided RMS magnitude spectrum in the waveform unit, or in dB relative to it.
+type Spectrum struct {
+	Resolution float64   `json:"resolution"`
+	Magnitudes []float64 `json:"magnitudes"`
+	Unit       string    `json:"unit"`
+}
+
+func (s *Spectrum) Frequency(i int) float64 {
+	return float64(i) * s.Resolution
+}
+
+// DB returns the spectrum converted to dB relative to 1 unit, such as dBV for volts.
+func (s *Spectrum) DB() *Spectrum {
+	if strings.HasPrefix(s.Unit, "dB") {
+		return s
+	}
+	result := &Spectrum{Resolution: s.Resolution, Unit: "dB" + s.Unit, Magnitudes: make([]float64, len(s.Magnitudes))}
+	for i, m := range s.Magnitudes {
+		result.Magnitudes[i] = 20 * math.Log10(math.Max(m, 1e-12))
+	}
+	return result
+}
+
+// Compute returns the RMS magnitude spectrum of the windowed waveform, zero padded to a power of two.
+func Compute(w *waveform.Waveform, window Window) (*Spectrum, error) {
+	n := len(w.Samples)
+	if n < 2 || w.Interval <= 0 {
+		return nil, fmt.Errorf("waveform too short for a spectrum")
+	}
+	size := 1
+	for size < n {
+		size *= 2
+	}
+	coefs := window.coefficients(n)
+	gain := 0.0
+	x := make([]complex128, size)
+	for i, v := range w.Samples {
+		x[i] = complex(v*coefs[i], 0)
+		gain += coefs[i]
+	}
+	transform(x)
+	result := &Spectrum{Resolution: 1 / (float64(size) * w.Interval), Unit: w.Unit, Magnitudes: make([]float64, size/2+1)}
+	for k := range result.Magnitudes {
+		m := cmplx.Abs(x[k]) / gain
+		// single sided, the dc and nyquist bins are not doubled
+		if k > 0 && k < size/2 {
+			m *= math.Sqrt2
+		}
+		result.Magnitudes[k] = m
+	}
+	return result, nil
+}
+
+// transform is an in place iterative radix-2 FFT, len(x) must be a power of two
+func transform(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		w := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			wk := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				a, b := x[start+k], x[start+k+size/2]*wk
+				x[start+k], x[start+k+size/2] = a+b, a-b
+				wk *= w
+			}
+		}
+	}
+}
+
+// Averager averages the power of successive spectra, and restarts when the resolution, unit or size changes.
+// Once Count spectra are averaged, it continues as an exponential average.
+type Averager struct {
+	Count int
+	power []float64
+	res   float64
+	unit  string
+	n     int
+}
+
+func (a *Averager) Add(s *Spectrum) {
+	if s.Resolution != a.res || s.Unit != a.unit || len(s.Magnitudes) != len(a.power) {
+		a.Reset()
+		a.res = s.Resolution
+		a.unit = s.Unit
+		a.power = make([]float64, len(s.Magnitudes))
+	}
+	if a.Count > 0 && a.n >= a.Count {
+		// exponential average once the count is reached
+		for i, m := range s.Magnitudes {
+			a.power[i] += (m*m - a.power[i]) / float64(a.Count)
+		}
+		return
+	}
+	a.n++
+	for i, m := range s.Magnitudes {
+		a.power[i] += (m*m - a.power[i]) / float64(a.n)
+	}
+}
+
+func (a *Averager) Reset() {
+	a.power = nil
+	a.n = 0
+}
+
+func (a *Averager) Spectrum() *Spectrum {
+	result := &Spectrum{Resolution: a.res, Unit: a.unit, Magnitudes: make([]float64, len(a.power))}
+	for i, p := range a.power {
+		result.Magnitudes[i] = math.Sqrt(p)
+	}
+	return result
+}
+
+type Peak struct {
+	Frequency float64 `json:"frequency"`
+	Magnitude float64 `json:"magnitude"`
+}
+
+// Peaks returns up to n local maxima of the spectrum, the highest first, ignoring the dc bin.
+func Peaks(s *Spectrum, n int) []Peak {
+	result := []Peak{}
+	m := s.Magnitudes
+	for i := 1; i < len(m); i++ {
+		if m[i] > m[i-1] && (i == len(m)-1 || m[i] >= m[i+1]) {
+			result = append(result, Peak{Frequency: s.Frequency(i), Magnitude: m[i]})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Magnitude > result[j].Magnitude })
+	if len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
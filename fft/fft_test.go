@@ -0,0 +1,60 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fft
+
+import (
+	"github.com/frnckdlprt/hdsctl/waveform"
+	"math"
+	"testing"
+)
+
+func Test_spectrum(t *testing.T) {
+	// 1V amplitude sine at 1kHz sampled at 64kHz, 0.5V dc
+	w := &waveform.Waveform{Unit: "V", Interval: 1.0 / 64000}
+	for i := 0; i < 1024; i++ {
+		w.Samples = append(w.Samples, 0.5+math.Sin(2*math.Pi*1000*w.Time(i)))
+	}
+	for _, window := range []Window{Rectangular, Hann, FlatTop} {
+		s, err := Compute(w, window)
+		if err != nil {
+			t.Fatal(err)
+		}
+		peaks := Peaks(s, 1)
+		if len(peaks) != 1 || peaks[0].Frequency != 1000 || math.Abs(peaks[0].Magnitude-1/math.Sqrt2) > 0.01 {
+			t.Errorf("unexpected %v peak: %v", window, peaks)
+		}
+		if math.Abs(s.Magnitudes[0]-0.5) > 0.01 {
+			t.Errorf("unexpected %v dc: %v", window, s.Magnitudes[0])
+		}
+		if db := s.DB().Magnitudes[16]; math.Abs(db+3.01) > 0.1 {
+			t.Errorf("unexpected %v dBV: %v", window, db)
+		}
+	}
+}
+
+func Test_averager(t *testing.T) {
+	a := &Averager{Count: 2}
+	a.Add(&Spectrum{Resolution: 1, Unit: "V", Magnitudes: []float64{1, 0}})
+	a.Add(&Spectrum{Resolution: 1, Unit: "V", Magnitudes: []float64{1, 2}})
+	if m := a.Spectrum().Magnitudes; m[0] != 1 || m[1] != math.Sqrt2 {
+		t.Fatalf("unexpected average: %v", m)
+	}
+	a.Add(&Spectrum{Resolution: 2, Unit: "V", Magnitudes: []float64{3, 3}})
+	if m := a.Spectrum().Magnitudes; m[0] != 3 {
+		t.Fatalf("average should restart on resolution change: %v", m)
+	}
+}
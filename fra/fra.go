@@ -0,0 +1,345 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fra
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"github.com/frnckdlprt/hdsctl"
+	"github.com/frnckdlprt/hdsctl/sweep"
+	"github.com/frnckdlprt/hdsctl/waveform"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// raw units from the center to the edge of the screen, and the smallest peak to peak span kept when ranging
+const (
+	screenUnits = 4 * hdsctl.UnitsPerDivision
+	minSpan     = 2 * hdsctl.UnitsPerDivision
+)
+
+// gain in dB reported without output signal, well below any ratio of 8 bit samples
+const minGain = -200.0
+
+type Options struct {
+	// first and last frequencies in hertz, with log spaced steps
+	Start float64
+	Stop  float64
+	Steps int
+	// generator amplitude in volts peak to peak, unchanged when 0
+	Amplitude float64
+	// settling time after each frequency change
+	Dwell time.Duration
+	// minimum number of periods on screen, 3 when 0
+	Periods float64
+	// maximum number of acquisitions to range the channels at each step, 6 when 0
+	MaxRanging int
+	// settling time after a scale change, 200ms when 0; acquisitions always wait at least a screen duration
+	RangeDelay time.Duration
+}
+
+// Point is the response at a frequency: the gain in dB and the phase in degrees of CH2, the output,
+// relative to CH1, the input, along with their amplitudes in volts peak
+type Point struct {
+	Frequency float64 `json:"frequency"`
+	Gain      float64 `json:"gain"`
+	Phase     float64 `json:"phase"`
+	Input     float64 `json:"input"`
+	Output    float64 `json:"output"`
+	Warning   string  `json:"warning,omitempty"`
+}
+
+type scale struct {
+	text  string
+	value float64
+}
+
+// Analyzer measures the response of a circuit driven by the generator, ranging the channels and the time base
+type Analyzer struct {
+	hds         *hdsctl.HDS
+	opts        Options
+	gen         *hdsctl.Generator
+	voltsScales []scale
+}
+
+func NewAnalyzer(hds *hdsctl.HDS, opts Options) (*Analyzer, error) {
+	if opts.Periods <= 0 {
+		opts.Periods = 3
+	}
+	if opts.MaxRanging <= 0 {
+		opts.MaxRanging = 6
+	}
+	if opts.RangeDelay <= 0 {
+		opts.RangeDelay = 200 * time.Millisecond
+	}
+	a := &Analyzer{hds: hds, opts: opts, gen: hdsctl.NewGenerator(hds)}
+	var err error
+	if a.voltsScales, err = scales(hds, ":CH1:SCALe"); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// scales returns the distinct values of the range of a scale field, in increasing order
+func scales(hds *hdsctl.HDS, field string) (result []scale, err error) {
+	cd := hds.Client.GetCommandDefinitionByName(field)
+	if cd == nil || len(cd.ValueRange) == 0 {
+		return nil, fmt.Errorf("no range for %s", field)
+	}
+	seen := map[float64]bool{}
+	for _, s := range cd.ValueRange {
+		v, _, err := hdsctl.ParseValue(s)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, scale{text: s, value: v})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].value < result[j].value })
+	return result, nil
+}
+
+// Setup outputs a sine wave from the generator, and displays both channels centered
+func (a *Analyzer) Setup() error {
+	if err := a.gen.SetWaveform(hdsctl.Sine); err != nil {
+		return err
+	}
+	if a.opts.Amplitude > 0 {
+		if err := a.gen.SetAmplitude(a.opts.Amplitude); err != nil {
+			return err
+		}
+	}
+	for ch := 1; ch <= 2; ch++ {
+		if err := a.hds.Client.Set(fmt.Sprintf(":CH%d:DISPlay ON", ch)); err != nil {
+			return fmt.Errorf("failed to display CH%d: %w", ch, err)
+		}
+		if err := a.hds.Client.Set(fmt.Sprintf(":CH%d:OFFSet 0", ch)); err != nil {
+			return fmt.Errorf("failed to center CH%d: %w", ch, err)
+		}
+	}
+	return a.gen.Output(true)
+}
+
+// MeasureAt sets the generator frequency, waits for the dwell time, and returns the response
+func (a *Analyzer) MeasureAt(hz float64) (*Point, error) {
+	if err := a.gen.SetFrequency(hz); err != nil {
+		return nil, err
+	}
+	time.Sleep(a.opts.Dwell)
+	return a.Measure(hz)
+}
+
+// Measure ranges the time base and the channels for the frequency the generator is set at, and
+// returns the response
+func (a *Analyzer) Measure(hz float64) (*Point, error) {
+	if err := a.hds.FitTimeBase(hz, a.opts.Periods); err != nil {
+		return nil, err
+	}
+	if err := a.settle(0); err != nil {
+		return nil, err
+	}
+	frame, warning, err := a.autorange()
+	if err != nil {
+		return nil, err
+	}
+	p, err := Analyze(frame, hz)
+	if err != nil {
+		return nil, err
+	}
+	if warning != "" && p.Warning != "" {
+		warning += ", "
+	}
+	p.Warning = warning + p.Warning
+	return p, nil
+}
+
+// autorange acquires frames until both channels span between 2 divisions and the screen height,
+// it returns the last frame, with a warning when a channel could not be ranged
+func (a *Analyzer) autorange() (frame *hdsctl.Frame, warning string, err error) {
+	for attempt := 0; ; attempt++ {
+		frame, err = a.hds.Acquire()
+		if err != nil {
+			return nil, "", err
+		}
+		changed := false
+		warnings := []string{}
+		for ch := 1; ch <= 2; ch++ {
+			hc, err := frame.Header.Channel(ch)
+			if err != nil {
+				return nil, "", err
+			}
+			current, _, err := hdsctl.ParseValue(hc.Scale)
+			if err != nil {
+				return nil, "", err
+			}
+			i := sort.Search(len(a.voltsScales), func(i int) bool { return a.voltsScales[i].value >= current })
+			low, high := math.Inf(1), math.Inf(-1)
+			for _, v := range frame.Waves[ch] {
+				low, high = math.Min(low, float64(v)), math.Max(high, float64(v))
+			}
+			next := i
+			switch {
+			case high > screenUnits || low < -screenUnits:
+				next++
+			case high-low < minSpan:
+				next--
+			}
+			if next < 0 || next >= len(a.voltsScales) {
+				warnings = append(warnings, fmt.Sprintf("CH%d out of range", ch))
+				continue
+			}
+			if next != i {
+				if err := a.hds.Client.Set(fmt.Sprintf(":CH%d:SCALe %s", ch, a.voltsScales[next].text)); err != nil {
+					return nil, "", fmt.Errorf("failed to range CH%d: %w", ch, err)
+				}
+				changed = true
+			}
+		}
+		if changed && attempt+1 >= a.opts.MaxRanging {
+			warnings = append(warnings, "ranging did not settle")
+		}
+		warning = strings.Join(warnings, ", ")
+		if !changed || attempt+1 >= a.opts.MaxRanging {
+			break
+		}
+		if err := a.settle(a.opts.RangeDelay); err != nil {
+			return nil, "", err
+		}
+	}
+	return frame, warning, nil
+}
+
+// settle waits for the delay, and at least for a screen duration so that the next acquisition
+// shows a whole screen taken with the new frequency and settings
+func (a *Analyzer) settle(delay time.Duration) error {
+	s, err := a.hds.Client.GetString(":HORizontal:SCALe?")
+	if err != nil {
+		return fmt.Errorf("failed to get time base: %w", err)
+	}
+	scale, _, err := hdsctl.ParseValue(s)
+	if err != nil {
+		return fmt.Errorf("failed to parse time base: %w", err)
+	}
+	if screen := time.Duration(scale * hdsctl.HorizontalDivisions * float64(time.Second)); screen > delay {
+		delay = screen
+	}
+	time.Sleep(delay)
+	return nil
+}
+
+// Analyze returns the response of CH2 relative to CH1 at the frequency, both channels being
+// correlated with a sine over a whole number of periods. Without output signal the gain is
+// minGain, with a warning.
+func Analyze(frame *hdsctl.Frame, hz float64) (*Point, error) {
+	win, err := frame.Waveform(1)
+	if err != nil {
+		return nil, err
+	}
+	wout, err := frame.Waveform(2)
+	if err != nil {
+		return nil, err
+	}
+	in, inPhase, err := phasor(win, hz)
+	if err != nil {
+		return nil, err
+	}
+	out, outPhase, err := phasor(wout, hz)
+	if err != nil {
+		return nil, err
+	}
+	if in == 0 {
+		return nil, fmt.Errorf("no input signal at %v Hz", hz)
+	}
+	phase := math.Mod(outPhase-inPhase, 2*math.Pi)
+	if phase > math.Pi {
+		phase -= 2 * math.Pi
+	} else if phase <= -math.Pi {
+		phase += 2 * math.Pi
+	}
+	p := &Point{Frequency: hz, Gain: minGain, Phase: phase * 180 / math.Pi, Input: in, Output: out}
+	if out == 0 {
+		p.Warning = "no output signal"
+	} else {
+		p.Gain = math.Max(20*math.Log10(out/in), minGain)
+	}
+	return p, nil
+}
+
+// phasor returns the amplitude and the phase of the frequency component of the waveform
+func phasor(w *waveform.Waveform, hz float64) (amplitude, phase float64, err error) {
+	periods := math.Floor(w.Duration() * hz)
+	if periods < 1 {
+		return 0, 0, fmt.Errorf("less than a period of %v Hz in %s", hz, w.Name)
+	}
+	n := int(math.Round(periods / hz / w.Interval))
+	if n > len(w.Samples) {
+		n = len(w.Samples)
+	}
+	var re, im float64
+	for i, v := range w.Samples[:n] {
+		x := 2 * math.Pi * hz * float64(i) * w.Interval
+		re += v * math.Cos(x)
+		im -= v * math.Sin(x)
+	}
+	return 2 * math.Hypot(re, im) / float64(n), math.Atan2(im, re), nil
+}
+
+// Run sweeps the generator frequency on a log scale and measures the response at each step, passing
+// each point to fn as it is measured
+func Run(ctx context.Context, hds *hdsctl.HDS, opts Options, fn func(p *Point) error) (points []*Point, err error) {
+	a, err := NewAnalyzer(hds, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.Setup(); err != nil {
+		return nil, err
+	}
+	so := sweep.Options{Parameter: sweep.Frequency, Start: opts.Start, Stop: opts.Stop, Steps: opts.Steps, Log: true, Dwell: opts.Dwell}
+	_, err = sweep.Run(ctx, hds, so, func(step *sweep.Step) error {
+		p, err := a.Measure(step.Value)
+		if err != nil {
+			return fmt.Errorf("failed to measure %.6g Hz: %w", step.Value, err)
+		}
+		points = append(points, p)
+		return fn(p)
+	})
+	return points, err
+}
+
+func WriteCSV(w io.Writer, points []*Point) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"frequency", "gain_db", "phase_deg", "input_v", "output_v", "warning"})
+	for _, p := range points {
+		cw.Write([]string{format(p.Frequency), format(p.Gain), format(p.Phase), format(p.Input), format(p.Output), p.Warning})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("failed to write csv: %w", err)
+	}
+	return nil
+}
+
+func format(v float64) string {
+	return strconv.FormatFloat(v, 'g', 6, 64)
+}
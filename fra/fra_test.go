@@ -0,0 +1,87 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fra
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/frnckdlprt/hdsctl"
+	"github.com/frnckdlprt/hdsctl/scpi"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_run(t *testing.T) {
+	// the mock feeds CH2 through a first order low pass filter with a 1kHz cutoff
+	hds := hdsctl.NewHDS(scpi.NewHDSClient(scpi.NewMockExecutor()))
+	opts := Options{Start: 100, Stop: 10000, Steps: 3, Amplitude: 2, RangeDelay: time.Millisecond}
+	progress := 0
+	points, err := Run(context.Background(), hds, opts, func(p *Point) error {
+		progress++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 3 || progress != 3 {
+		t.Fatalf("unexpected points: %v", points)
+	}
+	for _, p := range points {
+		gain := -10 * math.Log10(1+math.Pow(p.Frequency/1000, 2))
+		phase := -math.Atan(p.Frequency/1000) * 180 / math.Pi
+		if math.Abs(p.Gain-gain) > 0.3 || math.Abs(p.Phase-phase) > 2 || p.Warning != "" {
+			t.Fatalf("unexpected response at %v Hz: %+v, expected %.2f dB %.1f°", p.Frequency, p, gain, phase)
+		}
+		if math.Abs(p.Input-1) > 0.05 {
+			t.Fatalf("unexpected input amplitude at %v Hz: %v", p.Frequency, p.Input)
+		}
+	}
+	buff := &bytes.Buffer{}
+	if err := WriteCSV(buff, points); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(buff.String()), "\n"); len(lines) != 4 || !strings.HasPrefix(lines[2], "1000,-3.0") {
+		t.Fatalf("unexpected csv: %v", buff.String())
+	}
+}
+
+func Test_analyzeNoOutput(t *testing.T) {
+	hds := hdsctl.NewHDS(scpi.NewHDSClient(scpi.NewMockExecutor()))
+	for _, cmd := range []string{":CH2:DISPlay ON", ":CHANnel ON"} {
+		if err := hds.Client.Set(cmd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	frame, err := hds.Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame.Waves[2] = make([]int8, len(frame.Waves[1]))
+	p, err := Analyze(frame, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Gain != minGain || p.Output != 0 || p.Warning == "" {
+		t.Fatalf("unexpected point without output: %+v", p)
+	}
+	if _, err := json.Marshal(p); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hdsctl
+
+import (
+	"errors"
+	"fmt"
+	"github.com/frnckdlprt/hdsctl/waveform"
+	"time"
+)
+
+const acquireAttempts = 5
+
+var ErrSettingsChanged = errors.New("settings changed during acquisition")
+
+// Frame is a consistent acquisition: the screen header and the waves of every displayed channel.
+type Frame struct {
+	Seq       uint64         `json:"seq"`
+	Timestamp time.Time      `json:"timestamp"`
+	Header    *Header        `json:"header"`
+	Waves     map[int][]int8 `json:"waves"`
+	// volts of a computed frame, such as an average, that the raw waves only hold rounded
+	volts map[int][]float64
+}
+
+func (frame *Frame) Channels() []int {
+	result := []int{}
+	for ch := 1; ch <= len(frame.Header.Channels); ch++ {
+		if _, ok := frame.Waves[ch]; ok {
+			result = append(result, ch)
+		}
+	}
+	return result
+}
+
+// Volts returns the samples of the given channel converted to volts.
+func (frame *Frame) Volts(ch int) ([]float64, error) {
+	wave, ok := frame.Waves[ch]
+	if !ok {
+		return nil, fmt.Errorf("no wave for channel %v", ch)
+	}
+	if volts, ok := frame.volts[ch]; ok {
+		return append([]float64{}, volts...), nil
+	}
+	hc, err := frame.Header.Channel(ch)
+	if err != nil {
+		return nil, err
+	}
+	return hc.Volts(wave)
+}
+
+// Waveform returns the given channel in volts along with its time base.
+func (frame *Frame) Waveform(ch int) (*waveform.Waveform, error) {
+	volts, err := frame.Volts(ch)
+	if err != nil {
+		return nil, err
+	}
+	dt, err := frame.Header.SampleInterval()
+	if err != nil {
+		return nil, err
+	}
+	t0, err := frame.Header.Time(0)
+	if err != nil {
+		return nil, err
+	}
+	return &waveform.Waveform{Name: frame.Header.Channels[ch-1].Name, Unit: "V", Start: t0, Interval: dt, Samples: volts}, nil
+}
+
+func (hds *HDS) GetHeader() (header *Header, err error) {
+	b, err := hds.Client.GetBytes(":DATa:WAVe:SCReen:HEAD?")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get header: %w", err)
+	}
+	return ParseHeader(b)
+}
+
+// Acquire fetches the header and the waves of the displayed channels, retrying
+// when the settings changed between the first and the last command.
+func (hds *HDS) Acquire() (frame *Frame, err error) {
+	hds.acquireSync.Lock()
+	defer hds.acquireSync.Unlock()
+	for i := 0; i < acquireAttempts; i++ {
+		frame, err = hds.acquire()
+		if err == nil {
+			return frame, nil
+		}
+		if !errors.Is(err, ErrSettingsChanged) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("failed to acquire after %v attempts: %w", acquireAttempts, err)
+}
+
+func (hds *HDS) acquire() (frame *Frame, err error) {
+	ts := time.Now()
+	before, err := hds.GetHeader()
+	if err != nil {
+		return nil, err
+	}
+	waves := map[int][]int8{}
+	for i, hc := range before.Channels {
+		if hc.Display != "ON" {
+			continue
+		}
+		wav, err := hds.Client.GetWave(i + 1)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get CH%v wave: %w", i+1, err)
+		}
+		samples := make([]int8, len(wav))
+		for j, w := range wav {
+			samples[j] = int8(w)
+		}
+		waves[i+1] = samples
+	}
+	after, err := hds.GetHeader()
+	if err != nil {
+		return nil, err
+	}
+	if !before.SameSettings(after) {
+		return nil, ErrSettingsChanged
+	}
+	hds.frameSeq++
+	return &Frame{Seq: hds.frameSeq, Timestamp: ts, Header: after, Waves: waves}, nil
+}
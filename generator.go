@@ -0,0 +1,267 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hdsctl
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AWGShape is a waveform of the arbitrary function generator, valued as its scpi argument
+type AWGShape string
+
+const (
+	Sine        AWGShape = "SINE"
+	Square      AWGShape = "SQUare"
+	Ramp        AWGShape = "RAMP"
+	Pulse       AWGShape = "PULSe"
+	AmpALT      AWGShape = "AmpALT"
+	AttALT      AWGShape = "AttALT"
+	StairDown   AWGShape = "StairDn"
+	StairUpDown AWGShape = "StairUD"
+	StairUp     AWGShape = "StairUp"
+	BesselJ     AWGShape = "Besselj"
+	BesselY     AWGShape = "Bessely"
+	Sinc        AWGShape = "Sinc"
+)
+
+var AWGShapes = []AWGShape{Sine, Square, Ramp, Pulse, AmpALT, AttALT, StairDown, StairUpDown, StairUp, BesselJ, BesselY, Sinc}
+
+// ParseAWGShape accepts the scpi arguments in any case, and the short forms SQU and PULS
+func ParseAWGShape(s string) (AWGShape, error) {
+	for _, shape := range AWGShapes {
+		short := strings.TrimRight(string(shape), "abcdefghijklmnopqrstuvwxyz")
+		if strings.EqualFold(s, string(shape)) || (shape == Square || shape == Pulse) && strings.EqualFold(s, short) {
+			return shape, nil
+		}
+	}
+	return "", fmt.Errorf("invalid awg waveform: %s", s)
+}
+
+// the firmware reads levels in millivolts and frequencies in microhertz, but takes volts and hertz
+const (
+	awgVoltsScale     = 1e-3
+	awgFrequencyScale = 1e-6
+	// decimals of the values taken, down to the firmware resolution
+	awgVoltsDecimals     = 3
+	awgFrequencyDecimals = 6
+	awgPercentDecimals   = 1
+)
+
+// Generator drives the arbitrary function generator in volts and hertz. The amplitude and
+// offset, and the high and low levels, are two views of the same settings: setting one
+// of them updates the other view. The period is set through the frequency.
+type Generator struct {
+	hds *HDS
+}
+
+func NewGenerator(hds *HDS) *Generator {
+	return &Generator{hds: hds}
+}
+
+// set writes a value in base units, rounded to the given decimals without trailing zeros
+func (g *Generator) set(field string, v float64, decimals int) error {
+	s := strconv.FormatFloat(v, 'f', decimals, 64)
+	if strings.Contains(s, ".") {
+		s = strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+	}
+	if err := g.hds.Client.Set(fmt.Sprintf("%s %s", field, s)); err != nil {
+		return fmt.Errorf("failed to set %s: %w", field, err)
+	}
+	return nil
+}
+
+// get reads a value in base units, plain numbers being in the firmware units given by scale
+func (g *Generator) get(field string, scale float64) (float64, error) {
+	s, err := g.hds.Client.GetString(field + "?")
+	if err != nil {
+		return 0, fmt.Errorf("failed to get %s: %w", field, err)
+	}
+	v, unit, err := ParseValue(s)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get %s: %w", field, err)
+	}
+	if unit == "" {
+		v *= scale
+	}
+	return v, nil
+}
+
+func (g *Generator) SetWaveform(shape AWGShape) error {
+	if err := g.hds.Client.Set(":FUNCtion " + string(shape)); err != nil {
+		return fmt.Errorf("failed to set awg waveform %s: %w", shape, err)
+	}
+	return nil
+}
+
+func (g *Generator) Waveform() (AWGShape, error) {
+	s, err := g.hds.Client.GetString(":FUNCtion?")
+	if err != nil {
+		return "", fmt.Errorf("failed to get awg waveform: %w", err)
+	}
+	return ParseAWGShape(s)
+}
+
+func (g *Generator) SetFrequency(hz float64) error {
+	if hz <= 0 {
+		return fmt.Errorf("invalid awg frequency: %v", hz)
+	}
+	return g.set(":FUNCtion:FREQuency", hz, awgFrequencyDecimals)
+}
+
+func (g *Generator) Frequency() (float64, error) {
+	return g.get(":FUNCtion:FREQuency", awgFrequencyScale)
+}
+
+func (g *Generator) SetPeriod(period time.Duration) error {
+	if period <= 0 {
+		return fmt.Errorf("invalid awg period: %v", period)
+	}
+	return g.SetFrequency(1 / period.Seconds())
+}
+
+func (g *Generator) Period() (time.Duration, error) {
+	hz, err := g.Frequency()
+	if err != nil || hz == 0 {
+		return 0, err
+	}
+	return time.Duration(float64(time.Second) / hz), nil
+}
+
+// SetAmplitude sets the peak to peak amplitude, keeping the offset
+func (g *Generator) SetAmplitude(vpp float64) error {
+	if vpp <= 0 {
+		return fmt.Errorf("invalid awg amplitude: %v", vpp)
+	}
+	return g.set(":FUNCtion:AMPLitude", vpp, awgVoltsDecimals)
+}
+
+func (g *Generator) Amplitude() (float64, error) {
+	return g.get(":FUNCtion:AMPLitude", awgVoltsScale)
+}
+
+// SetOffset sets the offset, keeping the amplitude
+func (g *Generator) SetOffset(v float64) error {
+	return g.set(":FUNCtion:OFFSet", v, awgVoltsDecimals)
+}
+
+func (g *Generator) Offset() (float64, error) {
+	return g.get(":FUNCtion:OFFSet", awgVoltsScale)
+}
+
+// SetLevels sets the high and low levels, in the order keeping high above low at every step
+func (g *Generator) SetLevels(high, low float64) error {
+	if high <= low {
+		return fmt.Errorf("invalid awg levels: high %v is not above low %v", high, low)
+	}
+	current, err := g.High()
+	if err != nil {
+		return err
+	}
+	if low >= current {
+		if err := g.SetHigh(high); err != nil {
+			return err
+		}
+		return g.SetLow(low)
+	}
+	if err := g.SetLow(low); err != nil {
+		return err
+	}
+	return g.SetHigh(high)
+}
+
+func (g *Generator) Levels() (high, low float64, err error) {
+	if high, err = g.High(); err != nil {
+		return 0, 0, err
+	}
+	if low, err = g.Low(); err != nil {
+		return 0, 0, err
+	}
+	return high, low, nil
+}
+
+func (g *Generator) SetHigh(v float64) error {
+	return g.set(":FUNCtion:HIGHt", v, awgVoltsDecimals)
+}
+
+func (g *Generator) High() (float64, error) {
+	return g.get(":FUNCtion:HIGHt", awgVoltsScale)
+}
+
+func (g *Generator) SetLow(v float64) error {
+	return g.set(":FUNCtion:LOW", v, awgVoltsDecimals)
+}
+
+func (g *Generator) Low() (float64, error) {
+	return g.get(":FUNCtion:LOW", awgVoltsScale)
+}
+
+// requireShape checks that a setting applies to the current waveform
+func (g *Generator) requireShape(setting string, shape AWGShape) error {
+	current, err := g.Waveform()
+	if err != nil {
+		return err
+	}
+	if current != shape {
+		return fmt.Errorf("awg %s only applies to the %s waveform, not %s", setting, shape, current)
+	}
+	return nil
+}
+
+// SetDuty sets the duty cycle of the pulse waveform, in percent
+func (g *Generator) SetDuty(percent float64) error {
+	if percent <= 0 || percent >= 100 {
+		return fmt.Errorf("invalid awg duty cycle: %v", percent)
+	}
+	if err := g.requireShape("duty cycle", Pulse); err != nil {
+		return err
+	}
+	return g.set(":FUNCtion:DTYCycle", percent, awgPercentDecimals)
+}
+
+// SetSymmetry sets the symmetry of the ramp waveform, the rising part in percent of the period
+func (g *Generator) SetSymmetry(percent float64) error {
+	if percent < 0 || percent > 100 {
+		return fmt.Errorf("invalid awg symmetry: %v", percent)
+	}
+	if err := g.requireShape("symmetry", Ramp); err != nil {
+		return err
+	}
+	return g.set(":FUNCtion:SYMMetry", percent, awgPercentDecimals)
+}
+
+// Output turns the generator output on or off
+func (g *Generator) Output(on bool) error {
+	v := "OFF"
+	if on {
+		v = "ON"
+	}
+	if err := g.hds.Client.Set(":CHANnel " + v); err != nil {
+		return fmt.Errorf("failed to set awg output: %w", err)
+	}
+	return nil
+}
+
+func (g *Generator) Enabled() (bool, error) {
+	v, err := g.hds.Client.GetString(":CHANnel?")
+	if err != nil {
+		return false, fmt.Errorf("failed to get awg output: %w", err)
+	}
+	return strings.EqualFold(v, "ON"), nil
+}
@@ -19,11 +19,16 @@ package hdsctl
 import (
 	"fmt"
 	"github.com/frnckdlprt/hdsctl/scpi"
+	"log"
+	"strings"
+	"sync"
 )
 
 type HDS struct {
-	Client scpi.Client
-	Data   *HDSData
+	Client      scpi.Client
+	Data        *HDSData
+	acquireSync sync.Mutex
+	frameSeq    uint64
 }
 
 func NewHDS(client scpi.Client) (result *HDS) {
@@ -52,6 +57,23 @@ func (hds *HDS) GetField(k string) (v string, err error) {
 	return "", fmt.Errorf("invalid field: %s", k)
 }
 
+// GetFields returns the current value of every field, except the binary waveform data
+func (hds *HDS) GetFields() map[string]string {
+	result := map[string]string{}
+	for _, f := range hds.Data.Fields {
+		if strings.HasPrefix(f.SCPI, ":DATa") {
+			continue
+		}
+		v, err := hds.GetField(f.Id)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		result[f.Id] = v
+	}
+	return result
+}
+
 type HDSField struct {
 	Id   string
 	SCPI string
@@ -17,9 +17,14 @@ limitations under the License.
 package hdsctl
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/frnckdlprt/hdsctl/scpi"
+	"math"
+	"strings"
 	"testing"
 	"time"
 )
@@ -206,3 +211,241 @@ func Test_set(t *testing.T) {
 		SetAndGet(t, client, test.k, test.v)
 	}
 }
+
+func Test_acquire(t *testing.T) {
+	hds := NewHDS(scpi.NewHDSClient(scpi.NewMockExecutor()))
+	assertNilErr(t, hds.Client.Execute(":CH2:DISP ON;:CH1:OFFS 1.0"))
+	frame, err := hds.Acquire()
+	assertNilErr(t, err)
+	if frame.Seq != 1 || len(frame.Waves) != 2 || len(frame.Waves[1]) != 300 {
+		t.Fatalf("unexpected frame: seq=%v waves=%v", frame.Seq, len(frame.Waves))
+	}
+	volts, err := frame.Volts(1)
+	assertNilErr(t, err)
+	if volts[0] != 0 {
+		t.Fatalf("unexpected CH1 volts: %v", volts[0])
+	}
+	frame, err = hds.Acquire()
+	assertNilErr(t, err)
+	if frame.Seq != 2 {
+		t.Fatalf("unexpected frame seq: %v", frame.Seq)
+	}
+}
+
+func Test_capture(t *testing.T) {
+	hds := NewHDS(scpi.NewHDSClient(scpi.NewMockExecutor()))
+	frame, err := hds.Capture(context.Background(), time.Second)
+	assertNilErr(t, err)
+	if len(frame.Waves[1]) != 300 {
+		t.Fatalf("unexpected frame: %v", frame.Waves)
+	}
+	assertNilErr(t, hds.Client.Set(":TRIG:STAT READY"))
+	err = hds.WaitTrigger(context.Background(), 100*time.Millisecond)
+	if !errors.Is(err, ErrTriggerTimeout) {
+		t.Fatalf("expected trigger timeout: %v", err)
+	}
+	// the scope is still stopped on the previous shot and reports it once more after each sweep
+	// mode change, which must not be taken for a new trigger
+	mock := scpi.NewMockExecutor()
+	mock.NoTrigger, mock.Lagging = true, true
+	hds = NewHDS(scpi.NewHDSClient(mock))
+	assertNilErr(t, hds.Client.Set(":TRIG:STAT STOP"))
+	_, err = hds.Capture(context.Background(), 100*time.Millisecond)
+	if !errors.Is(err, ErrTriggerTimeout) {
+		t.Fatalf("expected trigger timeout while stopped: %v", err)
+	}
+	// the trigger happens before the first status poll
+	mock.NoTrigger = false
+	assertNilErr(t, hds.Client.Set(":TRIG:STAT STOP"))
+	_, err = hds.Capture(context.Background(), 100*time.Millisecond)
+	assertNilErr(t, err)
+}
+
+func Test_record(t *testing.T) {
+	mock := scpi.NewMockExecutor()
+	mock.Lagging = true
+	hds := NewHDS(scpi.NewHDSClient(mock))
+	buff := &bytes.Buffer{}
+	sw := NewSegmentWriter(buff)
+	n, err := hds.Record(context.Background(), RecordOptions{Count: 3}, sw.Write)
+	assertNilErr(t, err)
+	if n != 3 {
+		t.Fatalf("unexpected recorded count: %v", n)
+	}
+	seqs := []uint64{}
+	assertNilErr(t, ReadSegments(buff, func(frame *Frame) error {
+		seqs = append(seqs, frame.Seq)
+		return nil
+	}))
+	if fmt.Sprint(seqs) != "[1 2 3]" {
+		t.Fatalf("unexpected recorded frames: %v", seqs)
+	}
+}
+
+func Test_accumulate(t *testing.T) {
+	hds := NewHDS(scpi.NewHDSClient(scpi.NewMockExecutor()))
+	frame, err := hds.Acquire()
+	assertNilErr(t, err)
+	withLevel := func(header *Header, v int8) *Frame {
+		return &Frame{Header: header, Waves: map[int][]int8{1: {v, v, v}}}
+	}
+	a := &Accumulator{Mode: AcquireAverage, Count: 3}
+	for _, v := range []int8{100, 10, 20, 31} {
+		a.Add(withLevel(frame.Header, v))
+	}
+	frames, err := a.Frames()
+	assertNilErr(t, err)
+	if a.Len() != 3 || len(frames) != 1 || frames[0].Waves[1][0] != 20 {
+		t.Fatalf("unexpected average of %v frames: %v", a.Len(), frames[0].Waves)
+	}
+	ws, err := a.Waveforms(1)
+	assertNilErr(t, err)
+	hc, _ := frame.Header.Channel(1)
+	vpu, _ := hc.VoltsPerUnit()
+	if ws[0].Name != "CH1_avg" || math.Abs(ws[0].Samples[0]-(61.0/3-hc.Offset)*vpu) > 1e-9 {
+		t.Fatalf("unexpected average waveform: %v %v", ws[0].Name, ws[0].Samples)
+	}
+	volts, err := frames[0].Volts(1)
+	assertNilErr(t, err)
+	if volts[0] != ws[0].Samples[0] {
+		t.Fatalf("unexpected average volts: %v", volts)
+	}
+	a.Mode = AcquireEnvelope
+	frames, err = a.Frames()
+	assertNilErr(t, err)
+	if len(frames) != 2 || frames[0].Waves[1][0] != 10 || frames[1].Waves[1][0] != 31 {
+		t.Fatalf("unexpected envelope: %v", frames)
+	}
+	// a scale change discards the accumulated frames
+	header := *frame.Header
+	header.Channels = append([]HeaderChannel{}, header.Channels...)
+	header.Channels[0].Scale = "5V"
+	if !a.Add(withLevel(&header, 50)) || a.Len() != 1 {
+		t.Fatalf("accumulator not reset on scale change: %v frames", a.Len())
+	}
+}
+
+func Test_dmm(t *testing.T) {
+	for _, test := range []struct {
+		s        string
+		mode     DMMMode
+		v        float64
+		unit     string
+		overload bool
+	}{
+		{"1.234mV", VoltsDC, 1.234e-3, "V", false},
+		{"12.5kΩ", Resistance, 12500, "Ω", false},
+		{"-0.52", CurrentAC, -0.52, "A", false},
+		{" OL ", Resistance, 0, "Ω", true},
+	} {
+		r, err := ParseReading(test.s, test.mode)
+		assertNilErr(t, err)
+		if r.Overload != test.overload || r.Unit != test.unit || (!r.Overload && math.Abs(r.Value-test.v) > 1e-12) {
+			t.Fatalf("unexpected reading of %q: %+v", test.s, r)
+		}
+	}
+	hds := NewHDS(scpi.NewHDSClient(scpi.NewMockExecutor()))
+	dmm := NewDMM(hds)
+	assertNilErr(t, dmm.SetMode(Resistance))
+	conf, err := hds.Client.GetString(":DMM:CONF?")
+	assertNilErr(t, err)
+	if conf != "R" {
+		t.Fatalf("unexpected dmm configuration: %v", conf)
+	}
+	if dmm.SetRange("mV") == nil {
+		t.Fatal("expected no manual range in resistance mode")
+	}
+	assertNilErr(t, dmm.SetMode(VoltsDC))
+	assertNilErr(t, dmm.SetRange("mV"))
+	assertNilErr(t, dmm.SetRelative(true))
+	rel, err := dmm.Relative()
+	assertNilErr(t, err)
+	if !rel {
+		t.Fatal("expected relative mode")
+	}
+	for i := 0; i < 3; i++ {
+		r, err := dmm.Read()
+		assertNilErr(t, err)
+		if r.String() != "1.234mV" {
+			t.Fatalf("unexpected reading: %v", r)
+		}
+	}
+	stats := dmm.Stats()
+	if stats.Count != 3 || stats.String() != "min=1.234mV max=1.234mV avg=1.234mV n=3" {
+		t.Fatalf("unexpected stats: %v", stats)
+	}
+}
+
+// sentExecutor keeps the arguments of the last command
+type sentExecutor struct {
+	scpi.Executor
+	args string
+}
+
+func (se *sentExecutor) Execute(cmd scpi.Command) ([]byte, error) {
+	se.args = strings.Join(cmd.Arguments, " ")
+	return se.Executor.Execute(cmd)
+}
+
+func Test_generator(t *testing.T) {
+	hds := NewHDS(scpi.NewHDSClient(scpi.NewMockExecutor()))
+	g := NewGenerator(hds)
+	assertNilErr(t, g.SetWaveform(Square))
+	shape, err := g.Waveform()
+	assertNilErr(t, err)
+	if shape != Square {
+		t.Fatalf("unexpected waveform: %v", shape)
+	}
+	assertNilErr(t, g.SetPeriod(2*time.Millisecond))
+	hz, err := g.Frequency()
+	assertNilErr(t, err)
+	if hz != 500 {
+		t.Fatalf("unexpected frequency: %v", hz)
+	}
+	// high and low follow the amplitude and offset, and the other way round
+	assertNilErr(t, g.SetAmplitude(3))
+	assertNilErr(t, g.SetOffset(0.5))
+	high, low, err := g.Levels()
+	assertNilErr(t, err)
+	if high != 2 || low != -1 {
+		t.Fatalf("unexpected levels: %v %v", high, low)
+	}
+	assertNilErr(t, g.SetLevels(5, 3))
+	ampl, err := g.Amplitude()
+	assertNilErr(t, err)
+	offs, err := g.Offset()
+	assertNilErr(t, err)
+	if ampl != 2 || offs != 4 {
+		t.Fatalf("unexpected amplitude and offset: %v %v", ampl, offs)
+	}
+	// values are sent with the decimals of the firmware resolution
+	sent := &sentExecutor{Executor: scpi.NewMockExecutor()}
+	sg := NewGenerator(NewHDS(scpi.NewHDSClient(sent)))
+	for _, test := range []struct {
+		set  func(float64) error
+		v    float64
+		args string
+	}{
+		{sg.SetAmplitude, 1.23456, "1.235"},
+		{sg.SetAmplitude, 3.3, "3.3"},
+		{sg.SetOffset, -0.25, "-0.25"},
+		{sg.SetFrequency, 1000.1, "1000.1"},
+		{sg.SetFrequency, 2000, "2000"},
+	} {
+		assertNilErr(t, test.set(test.v))
+		if sent.args != test.args {
+			t.Fatalf("unexpected value sent for %v: %v", test.v, sent.args)
+		}
+	}
+	if g.SetDuty(20) == nil || g.SetSymmetry(20) == nil {
+		t.Fatal("expected no duty cycle nor symmetry for a square waveform")
+	}
+	assertNilErr(t, g.SetWaveform(Pulse))
+	assertNilErr(t, g.SetDuty(20))
+	assertNilErr(t, g.Output(true))
+	on, err := g.Enabled()
+	assertNilErr(t, err)
+	if !on {
+		t.Fatal("expected awg output on")
+	}
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hdsctl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// the screen shows 12 horizontal divisions, and 25 sample units per vertical division
+const HorizontalDivisions = 12
+const UnitsPerDivision = 25.0
+
+// Header is the typed content of :DATa:WAVe:SCReen:HEAD
+type Header struct {
+	TimeBase  HeaderTimeBase  `json:"TIMEBASE"`
+	Sample    HeaderSample    `json:"SAMPLE"`
+	Channels  []HeaderChannel `json:"CHANNEL"`
+	DataType  string          `json:"DATATYPE"`
+	RunStatus string          `json:"RUNSTATUS"`
+	IDN       string          `json:"IDN"`
+	Model     string          `json:"MODEL"`
+	Trig      HeaderTrig      `json:"Trig"`
+}
+
+type HeaderTimeBase struct {
+	Scale   string  `json:"SCALE"`
+	HOffset float64 `json:"HOFFSET"`
+}
+
+type HeaderSample struct {
+	FullScreen int    `json:"FULLSCREEN"`
+	SlowMove   int    `json:"SLOWMOVE"`
+	DataLen    int    `json:"DATALEN"`
+	SampleRate string `json:"SAMPLERATE"`
+	Type       string `json:"TYPE"`
+	DepMem     string `json:"DEPMEM"`
+}
+
+type HeaderChannel struct {
+	Name      string  `json:"NAME"`
+	Display   string  `json:"DISPLAY"`
+	Coupling  string  `json:"COUPLING"`
+	Probe     string  `json:"PROBE"`
+	Scale     string  `json:"SCALE"`
+	Offset    float64 `json:"OFFSET"`
+	Frequence float64 `json:"FREQUENCE"`
+}
+
+type HeaderTrig struct {
+	Mode  string          `json:"Mode"`
+	Type  string          `json:"Type"`
+	Items HeaderTrigItems `json:"Items"`
+}
+
+type HeaderTrigItems struct {
+	Channel  string `json:"Channel"`
+	Level    string `json:"Level"`
+	Edge     string `json:"Edge"`
+	Coupling string `json:"Coupling"`
+	Sweep    string `json:"Sweep"`
+}
+
+func ParseHeader(b []byte) (header *Header, err error) {
+	// the usb response is prefixed by a 4 bytes length
+	if i := bytes.IndexByte(b, '{'); i > 0 {
+		b = b[i:]
+	}
+	header = &Header{}
+	if err := json.Unmarshal(b, header); err != nil {
+		return nil, fmt.Errorf("failed to parse header: %w", err)
+	}
+	// sometimes we get a bogus header data
+	if header.TimeBase.Scale == "" || len(header.Channels) == 0 {
+		return nil, fmt.Errorf("invalid header: %s", b)
+	}
+	return header, nil
+}
+
+func (header *Header) Channel(ch int) (*HeaderChannel, error) {
+	if ch < 1 || ch > len(header.Channels) {
+		return nil, fmt.Errorf("invalid channel number: %v", ch)
+	}
+	return &header.Channels[ch-1], nil
+}
+
+// SameSettings reports whether both headers describe the same acquisition settings,
+// ignoring the run status and the measured frequencies.
+func (header *Header) SameSettings(other *Header) bool {
+	if header.TimeBase != other.TimeBase || header.Sample != other.Sample || header.Trig != other.Trig {
+		return false
+	}
+	if len(header.Channels) != len(other.Channels) {
+		return false
+	}
+	for i := range header.Channels {
+		a, b := header.Channels[i], other.Channels[i]
+		a.Frequence, b.Frequence = 0, 0
+		if a != b {
+			return false
+		}
+	}
+	return true
+}
+
+// SampleInterval returns the time in seconds between two screen samples.
+func (header *Header) SampleInterval() (float64, error) {
+	scale, _, err := ParseValue(header.TimeBase.Scale)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse time base: %w", err)
+	}
+	n := header.screenLength()
+	if n <= 0 {
+		return 0, fmt.Errorf("invalid screen length: %v", n)
+	}
+	return scale * HorizontalDivisions / float64(n), nil
+}
+
+// SampleRate returns the acquisition sample rate in samples per second.
+func (header *Header) SampleRate() (float64, error) {
+	v, _, err := ParseValue(header.Sample.SampleRate)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse sample rate: %w", err)
+	}
+	return v, nil
+}
+
+// Time returns the time in seconds of the i-th screen sample, relative to the trigger point.
+func (header *Header) Time(i int) (float64, error) {
+	dt, err := header.SampleInterval()
+	if err != nil {
+		return 0, err
+	}
+	scale := dt * float64(header.screenLength()) / HorizontalDivisions
+	return float64(i-header.screenLength()/2)*dt + header.TimeBase.HOffset*scale, nil
+}
+
+func (header *Header) screenLength() int {
+	if header.Sample.FullScreen > 0 {
+		return header.Sample.FullScreen
+	}
+	return header.Sample.DataLen
+}
+
+// VoltsPerUnit returns the volts of one sample unit; the scale already includes the probe attenuation.
+func (ch *HeaderChannel) VoltsPerUnit() (float64, error) {
+	scale, _, err := ParseValue(ch.Scale)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s scale: %w", ch.Name, err)
+	}
+	return scale / UnitsPerDivision, nil
+}
+
+// Volts converts raw screen samples, which include the vertical offset, to volts.
+func (ch *HeaderChannel) Volts(raw []int8) ([]float64, error) {
+	vpu, err := ch.VoltsPerUnit()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]float64, len(raw))
+	for i, r := range raw {
+		result[i] = (float64(r) - ch.Offset) * vpu
+	}
+	return result, nil
+}
@@ -0,0 +1,245 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mask
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/frnckdlprt/hdsctl"
+	"github.com/frnckdlprt/hdsctl/waveform"
+	"io"
+	"math"
+	"os"
+)
+
+// number of violations kept in a result, the others are only counted
+const maxViolations = 100
+
+var ErrFailed = errors.New("mask test failed")
+
+type Point struct {
+	Time  float64 `json:"t"`
+	Volts float64 `json:"v"`
+}
+
+// Polygon is a forbidden region of a channel, in time and volts.
+type Polygon struct {
+	Channel int     `json:"channel"`
+	Points  []Point `json:"points"`
+}
+
+// Band is a tolerance band around a reference waveform of a channel: samples must stay within Volts of
+// the reference, which may be shifted by up to Time seconds.
+type Band struct {
+	Channel   int                `json:"channel"`
+	Reference *waveform.Waveform `json:"reference"`
+	Volts     float64            `json:"volts"`
+	Time      float64            `json:"time"`
+	lower     []float64
+	upper     []float64
+}
+
+// Mask is a set of forbidden polygons and tolerance bands.
+type Mask struct {
+	Polygons []Polygon `json:"polygons,omitempty"`
+	Bands    []*Band   `json:"bands,omitempty"`
+}
+
+type Violation struct {
+	Channel int     `json:"channel"`
+	Time    float64 `json:"time"`
+	Volts   float64 `json:"volts"`
+	// polygon or band
+	Rule  string `json:"rule"`
+	Index int    `json:"index"`
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("CH%v %gs %gV outside %s %v", v.Channel, v.Time, v.Volts, v.Rule, v.Index)
+}
+
+type Result struct {
+	Pass bool `json:"pass"`
+	// total number of violating samples, only the first ones are kept
+	Count      int         `json:"count"`
+	Violations []Violation `json:"violations"`
+}
+
+func (r *Result) add(v Violation) {
+	r.Pass = false
+	r.Count++
+	if len(r.Violations) < maxViolations {
+		r.Violations = append(r.Violations, v)
+	}
+}
+
+// Stats counts the passed and failed tests.
+type Stats struct {
+	Tested int `json:"tested"`
+	Passed int `json:"passed"`
+	Failed int `json:"failed"`
+}
+
+func (s *Stats) Add(r *Result) {
+	s.Tested++
+	if r.Pass {
+		s.Passed++
+	} else {
+		s.Failed++
+	}
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("tested %v, passed %v, failed %v", s.Tested, s.Passed, s.Failed)
+}
+
+// NewBand creates a tolerance band of volts and time around the reference.
+func NewBand(ch int, reference *waveform.Waveform, volts, time float64) *Band {
+	return &Band{Channel: ch, Reference: reference, Volts: volts, Time: time}
+}
+
+// Bounds returns the lower and upper limits of the band at each sample of the reference.
+func (b *Band) Bounds() (lower, upper []float64) {
+	if b.lower != nil {
+		return b.lower, b.upper
+	}
+	ref := b.Reference
+	n := len(ref.Samples)
+	b.lower, b.upper = make([]float64, n), make([]float64, n)
+	shift := 0
+	if ref.Interval > 0 {
+		shift = int(b.Time / ref.Interval)
+	}
+	for i := range ref.Samples {
+		lo, hi := math.Inf(1), math.Inf(-1)
+		for j := i - shift; j <= i+shift; j++ {
+			if j >= 0 && j < n {
+				lo, hi = math.Min(lo, ref.Samples[j]), math.Max(hi, ref.Samples[j])
+			}
+		}
+		b.lower[i], b.upper[i] = lo-b.Volts, hi+b.Volts
+	}
+	return b.lower, b.upper
+}
+
+// Contains reports whether the volts at time t are within the band, times outside of the reference are not tested.
+func (b *Band) Contains(t, v float64) bool {
+	ref := b.Reference
+	if ref.Interval <= 0 {
+		return true
+	}
+	i := int(math.Round((t - ref.Start) / ref.Interval))
+	if i < 0 || i >= len(ref.Samples) {
+		return true
+	}
+	lower, upper := b.Bounds()
+	return v >= lower[i] && v <= upper[i]
+}
+
+// Contains reports whether the point is inside the polygon, using the even-odd rule.
+func (p *Polygon) Contains(t, v float64) bool {
+	inside := false
+	pts := p.Points
+	for i, j := 0, len(pts)-1; i < len(pts); j, i = i, i+1 {
+		a, b := pts[i], pts[j]
+		if (a.Volts > v) != (b.Volts > v) && t < (b.Time-a.Time)*(v-a.Volts)/(b.Volts-a.Volts)+a.Time {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// Test checks every sample of the channels of the mask, the frame must display them.
+func (m *Mask) Test(frame *hdsctl.Frame) (*Result, error) {
+	result := &Result{Pass: true, Violations: []Violation{}}
+	waveforms := map[int]*waveform.Waveform{}
+	get := func(ch int) (*waveform.Waveform, error) {
+		if w, ok := waveforms[ch]; ok {
+			return w, nil
+		}
+		w, err := frame.Waveform(ch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to test mask: %w", err)
+		}
+		waveforms[ch] = w
+		return w, nil
+	}
+	for k, p := range m.Polygons {
+		w, err := get(p.Channel)
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range w.Samples {
+			if p.Contains(w.Time(i), v) {
+				result.add(Violation{Channel: p.Channel, Time: w.Time(i), Volts: v, Rule: "polygon", Index: k})
+			}
+		}
+	}
+	for k, b := range m.Bands {
+		w, err := get(b.Channel)
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range w.Samples {
+			if !b.Contains(w.Time(i), v) {
+				result.add(Violation{Channel: b.Channel, Time: w.Time(i), Volts: v, Rule: "band", Index: k})
+			}
+		}
+	}
+	return result, nil
+}
+
+func Read(r io.Reader) (*Mask, error) {
+	m := &Mask{}
+	if err := json.NewDecoder(r).Decode(m); err != nil {
+		return nil, fmt.Errorf("failed to read mask: %w", err)
+	}
+	for _, b := range m.Bands {
+		if b.Reference == nil {
+			return nil, fmt.Errorf("invalid mask: band of CH%v without reference", b.Channel)
+		}
+	}
+	return m, nil
+}
+
+func ReadFile(path string) (*Mask, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+func Write(w io.Writer, m *Mask) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(m); err != nil {
+		return fmt.Errorf("failed to write mask: %w", err)
+	}
+	return nil
+}
+
+func WriteFile(path string, m *Mask) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer f.Close()
+	return Write(f, m)
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mask
+
+import (
+	"bytes"
+	"github.com/frnckdlprt/hdsctl"
+	"github.com/frnckdlprt/hdsctl/scpi"
+	"testing"
+)
+
+func testFrame(t *testing.T) *hdsctl.Frame {
+	hds := hdsctl.NewHDS(scpi.NewHDSClient(scpi.NewMockExecutor()))
+	frame, err := hds.Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return frame
+}
+
+func Test_band(t *testing.T) {
+	frame := testFrame(t)
+	ref, err := frame.Waveform(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Mask{Bands: []*Band{NewBand(1, ref, 0.1, ref.Interval)}}
+	r, err := m.Test(frame)
+	if err != nil || !r.Pass {
+		t.Fatalf("reference does not pass: %v %v", r, err)
+	}
+	// a glitch of 20 units, much larger than the tolerance
+	glitch := &hdsctl.Frame{Header: frame.Header, Waves: map[int][]int8{1: append([]int8{}, frame.Waves[1]...)}}
+	glitch.Waves[1][150] += 20
+	r, err = m.Test(glitch)
+	if err != nil || r.Pass || r.Count != 1 || r.Violations[0].Time != ref.Time(150) {
+		t.Fatalf("glitch not detected: %v %v", r, err)
+	}
+	stats := Stats{}
+	stats.Add(r)
+	if stats.String() != "tested 1, passed 0, failed 1" {
+		t.Fatalf("unexpected stats: %v", stats)
+	}
+	b := &bytes.Buffer{}
+	if err := Write(b, m); err != nil {
+		t.Fatal(err)
+	}
+	m, err = Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, _ = m.Test(glitch); r.Pass {
+		t.Fatalf("glitch not detected after reading the mask")
+	}
+	if _, err := (&Mask{Bands: []*Band{NewBand(2, ref, 0.1, 0)}}).Test(&hdsctl.Frame{Header: frame.Header}); err == nil {
+		t.Fatalf("expected an error for a channel without wave")
+	}
+}
+
+func Test_polygon(t *testing.T) {
+	frame := testFrame(t)
+	w, err := frame.Waveform(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	max := 0.0
+	for _, v := range w.Samples {
+		if v > max {
+			max = v
+		}
+	}
+	start, end := w.Time(0), w.Time(len(w.Samples)-1)
+	above := Polygon{Channel: 1, Points: []Point{{start, max + 0.1}, {end, max + 0.1}, {end, max + 1}, {start, max + 1}}}
+	m := &Mask{Polygons: []Polygon{above}}
+	if r, err := m.Test(frame); err != nil || !r.Pass {
+		t.Fatalf("unexpected failure: %v %v", r, err)
+	}
+	below := Polygon{Channel: 1, Points: []Point{{start, max - 0.01}, {end, max - 0.01}, {end, max + 1}, {start, max + 1}}}
+	m.Polygons = append(m.Polygons, below)
+	r, err := m.Test(frame)
+	if err != nil || r.Pass || r.Violations[0].Rule != "polygon" || r.Violations[0].Index != 1 {
+		t.Fatalf("expected a failure: %v %v", r, err)
+	}
+}
@@ -0,0 +1,352 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mathchan
+
+import (
+	"fmt"
+	"github.com/frnckdlprt/hdsctl"
+	"github.com/frnckdlprt/hdsctl/waveform"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expr is a math channel expression over channels, such as "CH1-CH2", "CH1*CH2/50",
+// "d/dt(CH1)" or "integ(CH2)+0.5", with the usual operator precedence.
+type Expr struct {
+	src  string
+	root node
+}
+
+type node interface {
+	eval(channels map[string]*waveform.Waveform) (value, error)
+}
+
+// value is either a scalar or a vector of samples
+type value struct {
+	scalar float64
+	vec    []float64
+	unit   string
+	dt     float64
+}
+
+func Parse(s string) (*Expr, error) {
+	p := &parser{tokens: tokenize(s)}
+	root, err := p.expr()
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", s, err)
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("invalid expression %q: unexpected %s", s, p.tokens[p.pos])
+	}
+	return &Expr{src: s, root: root}, nil
+}
+
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Eval evaluates the expression over the named channels, which must share the same time base.
+func (e *Expr) Eval(name string, channels map[string]*waveform.Waveform) (*waveform.Waveform, error) {
+	var ref *waveform.Waveform
+	for _, w := range channels {
+		ref = w
+		break
+	}
+	v, err := e.root.eval(channels)
+	if err != nil {
+		return nil, err
+	}
+	if v.vec == nil {
+		return nil, fmt.Errorf("expression %q does not reference any channel", e.src)
+	}
+	return &waveform.Waveform{Name: name, Unit: v.unit, Start: ref.Start, Interval: ref.Interval, Samples: v.vec}, nil
+}
+
+// EvalFrame evaluates the expression over the channels of the frame.
+func (e *Expr) EvalFrame(name string, frame *hdsctl.Frame) (*waveform.Waveform, error) {
+	channels := map[string]*waveform.Waveform{}
+	for _, ch := range frame.Channels() {
+		w, err := frame.Waveform(ch)
+		if err != nil {
+			return nil, err
+		}
+		channels[w.Name] = w
+	}
+	return e.Eval(name, channels)
+}
+
+type number float64
+
+func (n number) eval(channels map[string]*waveform.Waveform) (value, error) {
+	return value{scalar: float64(n)}, nil
+}
+
+type channelRef string
+
+func (c channelRef) eval(channels map[string]*waveform.Waveform) (value, error) {
+	w, ok := channels[string(c)]
+	if !ok {
+		return value{}, fmt.Errorf("channel %s is not displayed", c)
+	}
+	return value{vec: w.Samples, unit: w.Unit, dt: w.Interval}, nil
+}
+
+type binary struct {
+	op          byte
+	left, right node
+}
+
+func (b *binary) eval(channels map[string]*waveform.Waveform) (value, error) {
+	l, err := b.left.eval(channels)
+	if err != nil {
+		return value{}, err
+	}
+	r, err := b.right.eval(channels)
+	if err != nil {
+		return value{}, err
+	}
+	result := value{dt: l.dt, unit: binaryUnit(b.op, l.unit, r.unit)}
+	if result.dt == 0 {
+		result.dt = r.dt
+	}
+	if l.vec == nil && r.vec == nil {
+		result.scalar = apply(b.op, l.scalar, r.scalar)
+		return result, nil
+	}
+	n := len(l.vec)
+	if l.vec == nil || (r.vec != nil && len(r.vec) < n) {
+		n = len(r.vec)
+	}
+	result.vec = make([]float64, n)
+	for i := range result.vec {
+		a, c := l.scalar, r.scalar
+		if l.vec != nil {
+			a = l.vec[i]
+		}
+		if r.vec != nil {
+			c = r.vec[i]
+		}
+		result.vec[i] = apply(b.op, a, c)
+	}
+	return result, nil
+}
+
+func apply(op byte, a, b float64) float64 {
+	switch op {
+	case '+':
+		return a + b
+	case '-':
+		return a - b
+	case '*':
+		return a * b
+	}
+	return a / b
+}
+
+func binaryUnit(op byte, l, r string) string {
+	switch {
+	case op == '+' || op == '-':
+		if l == "" {
+			return r
+		}
+		return l
+	case l == "" && op == '*':
+		return r
+	case r == "":
+		return l
+	case op == '/' && l == r:
+		return ""
+	}
+	return l + string(op) + r
+}
+
+type function struct {
+	name string
+	arg  node
+}
+
+func (f *function) eval(channels map[string]*waveform.Waveform) (value, error) {
+	v, err := f.arg.eval(channels)
+	if err != nil {
+		return value{}, err
+	}
+	if v.vec == nil {
+		return value{}, fmt.Errorf("%s requires a channel argument", f.name)
+	}
+	result := value{dt: v.dt, vec: make([]float64, len(v.vec))}
+	switch f.name {
+	case "deriv":
+		result.unit = v.unit + "/s"
+		for i := range v.vec {
+			lo, hi := i-1, i+1
+			if lo < 0 {
+				lo = 0
+			}
+			if hi >= len(v.vec) {
+				hi = len(v.vec) - 1
+			}
+			if hi > lo {
+				result.vec[i] = (v.vec[hi] - v.vec[lo]) / (float64(hi-lo) * v.dt)
+			}
+		}
+	case "integ":
+		result.unit = v.unit + "*s"
+		for i := 1; i < len(v.vec); i++ {
+			result.vec[i] = result.vec[i-1] + (v.vec[i-1]+v.vec[i])/2*v.dt
+		}
+	case "abs":
+		result.unit = v.unit
+		for i, x := range v.vec {
+			if x < 0 {
+				x = -x
+			}
+			result.vec[i] = x
+		}
+	}
+	return result, nil
+}
+
+var functions = map[string]string{"deriv": "deriv", "d/dt": "deriv", "integ": "integ", "abs": "abs"}
+
+func tokenize(s string) []string {
+	tokens := []string{}
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case strings.HasPrefix(string(runes[i:]), "d/dt"):
+			tokens = append(tokens, "d/dt")
+			i += 4
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.':
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '.') {
+				// exponent sign of numbers such as 1e-3
+				if j+1 < len(runes) && unicode.IsDigit(runes[i]) && (runes[j] == 'e' || runes[j] == 'E') && (runes[j+1] == '-' || runes[j+1] == '+') {
+					j++
+				}
+				j++
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		default:
+			tokens = append(tokens, string(r))
+			i++
+		}
+	}
+	return tokens
+}
+
+type parser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *parser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *parser) expr() (node, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "+" || p.peek() == "-" {
+		op := p.next()[0]
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) term() (node, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "*" || p.peek() == "/" {
+		op := p.next()[0]
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) unary() (node, error) {
+	if p.peek() == "-" {
+		p.next()
+		arg, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &binary{op: '-', left: number(0), right: arg}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (node, error) {
+	t := p.next()
+	switch {
+	case t == "":
+		return nil, fmt.Errorf("unexpected end")
+	case t == "(":
+		n, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		return n, nil
+	case functions[t] != "":
+		if p.next() != "(" {
+			return nil, fmt.Errorf("missing ( after %s", t)
+		}
+		arg, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		return &function{name: functions[t], arg: arg}, nil
+	case strings.HasPrefix(strings.ToUpper(t), "CH"):
+		return channelRef(strings.ToUpper(t)), nil
+	}
+	v, err := strconv.ParseFloat(t, 64)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected %s", t)
+	}
+	return number(v), nil
+}
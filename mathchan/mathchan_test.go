@@ -0,0 +1,68 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mathchan
+
+import (
+	"fmt"
+	"github.com/frnckdlprt/hdsctl/waveform"
+	"testing"
+)
+
+func Test_eval(t *testing.T) {
+	channels := map[string]*waveform.Waveform{
+		"CH1": {Name: "CH1", Unit: "V", Interval: 0.5, Samples: []float64{0, 1, 2, 3}},
+		"CH2": {Name: "CH2", Unit: "V", Interval: 0.5, Samples: []float64{1, 1, 1, 1}},
+	}
+	tests := []struct {
+		expr    string
+		unit    string
+		samples string
+	}{
+		{"CH1-CH2", "V", "[-1 0 1 2]"},
+		{"ch1 * CH2 / 2", "V*V", "[0 0.5 1 1.5]"},
+		{"-(CH1+1e-1)*10", "V", "[-1 -11 -21 -31]"},
+		{"2*CH1 + 0.5", "V", "[0.5 2.5 4.5 6.5]"},
+		{"d/dt(CH1)", "V/s", "[2 2 2 2]"},
+		{"integ(CH2)", "V*s", "[0 0.5 1 1.5]"},
+		{"CH1/CH2", "", "[0 1 2 3]"},
+	}
+	for _, test := range tests {
+		e, err := Parse(test.expr)
+		if err != nil {
+			t.Fatalf("failed to parse %s: %v", test.expr, err)
+		}
+		w, err := e.Eval("MATH", channels)
+		if err != nil {
+			t.Fatalf("failed to eval %s: %v", test.expr, err)
+		}
+		if w.Unit != test.unit || fmt.Sprint(w.Samples) != test.samples {
+			t.Errorf("unexpected %s: %v %s", test.expr, w.Samples, w.Unit)
+		}
+	}
+}
+
+func Test_invalid(t *testing.T) {
+	for _, s := range []string{"CH1+", "(CH1", "deriv CH1", "CH1 $ 2", ""} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("%q should not parse", s)
+		}
+	}
+	e, _ := Parse("1+2")
+	if _, err := e.Eval("MATH", map[string]*waveform.Waveform{}); err == nil {
+		t.Errorf("scalar expression should not evaluate")
+	}
+}
@@ -0,0 +1,363 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package measure
+
+import (
+	"github.com/frnckdlprt/hdsctl/waveform"
+	"math"
+)
+
+const histogramBins = 100
+
+type Measurement struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit"`
+	Valid bool    `json:"valid"`
+}
+
+type Options struct {
+	// reference levels as fractions of the base to top amplitude
+	LowRef  float64
+	MidRef  float64
+	HighRef float64
+	// hysteresis of the crossing detection as a fraction of the amplitude
+	Hysteresis float64
+}
+
+func DefaultOptions() Options {
+	return Options{LowRef: 0.1, MidRef: 0.5, HighRef: 0.9, Hysteresis: 0.1}
+}
+
+// Edge is a crossing of the mid reference level, confirmed by the hysteresis.
+type Edge struct {
+	Index  int
+	Time   float64
+	Rising bool
+}
+
+// Measurements computes every measurement of the waveform.
+func Measurements(w *waveform.Waveform, opts Options) []Measurement {
+	return []Measurement{
+		Max(w), Min(w), PkPk(w), Mean(w), RMS(w), ACRMS(w),
+		Top(w), Base(w), Amplitude(w),
+		Period(w, opts), Frequency(w, opts), PosWidth(w, opts), NegWidth(w, opts), DutyCycle(w, opts),
+		RiseTime(w, opts), FallTime(w, opts), Overshoot(w), Preshoot(w),
+	}
+}
+
+func Max(w *waveform.Waveform) Measurement {
+	m := Measurement{Name: "max", Unit: w.Unit, Valid: len(w.Samples) > 0}
+	for i, v := range w.Samples {
+		if i == 0 {
+			m.Value = v
+		}
+		m.Value = math.Max(m.Value, v)
+	}
+	return m
+}
+
+func Min(w *waveform.Waveform) Measurement {
+	m := Measurement{Name: "min", Unit: w.Unit, Valid: len(w.Samples) > 0}
+	for i, v := range w.Samples {
+		if i == 0 {
+			m.Value = v
+		}
+		m.Value = math.Min(m.Value, v)
+	}
+	return m
+}
+
+func PkPk(w *waveform.Waveform) Measurement {
+	return Measurement{Name: "pkpk", Unit: w.Unit, Value: Max(w).Value - Min(w).Value, Valid: len(w.Samples) > 0}
+}
+
+func Mean(w *waveform.Waveform) Measurement {
+	m := Measurement{Name: "mean", Unit: w.Unit, Valid: len(w.Samples) > 0}
+	for _, v := range w.Samples {
+		m.Value += v
+	}
+	if m.Valid {
+		m.Value /= float64(len(w.Samples))
+	}
+	return m
+}
+
+func RMS(w *waveform.Waveform) Measurement {
+	m := Measurement{Name: "rms", Unit: w.Unit, Valid: len(w.Samples) > 0}
+	for _, v := range w.Samples {
+		m.Value += v * v
+	}
+	if m.Valid {
+		m.Value = math.Sqrt(m.Value / float64(len(w.Samples)))
+	}
+	return m
+}
+
+// ACRMS is the RMS value with the DC component removed.
+func ACRMS(w *waveform.Waveform) Measurement {
+	mean := Mean(w).Value
+	m := Measurement{Name: "acrms", Unit: w.Unit, Valid: len(w.Samples) > 0}
+	for _, v := range w.Samples {
+		m.Value += (v - mean) * (v - mean)
+	}
+	if m.Valid {
+		m.Value = math.Sqrt(m.Value / float64(len(w.Samples)))
+	}
+	return m
+}
+
+// Top is the most frequent level of the upper half of the waveform, or its max when there is none.
+func Top(w *waveform.Waveform) Measurement {
+	return Measurement{Name: "top", Unit: w.Unit, Value: mode(w, true), Valid: len(w.Samples) > 0}
+}
+
+// Base is the most frequent level of the lower half of the waveform, or its min when there is none.
+func Base(w *waveform.Waveform) Measurement {
+	return Measurement{Name: "base", Unit: w.Unit, Value: mode(w, false), Valid: len(w.Samples) > 0}
+}
+
+func Amplitude(w *waveform.Waveform) Measurement {
+	top, base := Top(w), Base(w)
+	return Measurement{Name: "amplitude", Unit: w.Unit, Value: top.Value - base.Value, Valid: top.Valid && top.Value > base.Value}
+}
+
+func Overshoot(w *waveform.Waveform) Measurement {
+	amp := Amplitude(w)
+	m := Measurement{Name: "overshoot", Unit: "%", Valid: amp.Valid}
+	if m.Valid {
+		m.Value = (Max(w).Value - Top(w).Value) / amp.Value * 100
+	}
+	return m
+}
+
+func Preshoot(w *waveform.Waveform) Measurement {
+	amp := Amplitude(w)
+	m := Measurement{Name: "preshoot", Unit: "%", Valid: amp.Valid}
+	if m.Valid {
+		m.Value = (Base(w).Value - Min(w).Value) / amp.Value * 100
+	}
+	return m
+}
+
+func Period(w *waveform.Waveform, opts Options) Measurement {
+	m := Measurement{Name: "period", Unit: "s"}
+	m.Value, m.Valid = averageSpacing(Edges(w, opts), true)
+	if !m.Valid {
+		m.Value, m.Valid = averageSpacing(Edges(w, opts), false)
+	}
+	return m
+}
+
+func Frequency(w *waveform.Waveform, opts Options) Measurement {
+	p := Period(w, opts)
+	m := Measurement{Name: "frequency", Unit: "Hz", Valid: p.Valid && p.Value > 0}
+	if m.Valid {
+		m.Value = 1 / p.Value
+	}
+	return m
+}
+
+// PosWidth is the average time from a rising edge to the next falling edge.
+func PosWidth(w *waveform.Waveform, opts Options) Measurement {
+	m := Measurement{Name: "+width", Unit: "s"}
+	m.Value, m.Valid = averageWidth(Edges(w, opts), true)
+	return m
+}
+
+// NegWidth is the average time from a falling edge to the next rising edge.
+func NegWidth(w *waveform.Waveform, opts Options) Measurement {
+	m := Measurement{Name: "-width", Unit: "s"}
+	m.Value, m.Valid = averageWidth(Edges(w, opts), false)
+	return m
+}
+
+func DutyCycle(w *waveform.Waveform, opts Options) Measurement {
+	width, period := PosWidth(w, opts), Period(w, opts)
+	m := Measurement{Name: "duty", Unit: "%", Valid: width.Valid && period.Valid && period.Value > 0}
+	if m.Valid {
+		m.Value = width.Value / period.Value * 100
+	}
+	return m
+}
+
+// RiseTime is the average time of the rising edges between the low and high reference levels.
+func RiseTime(w *waveform.Waveform, opts Options) Measurement {
+	m := Measurement{Name: "risetime", Unit: "s"}
+	m.Value, m.Valid = transitionTime(w, opts, true)
+	return m
+}
+
+// FallTime is the average time of the falling edges between the high and low reference levels.
+func FallTime(w *waveform.Waveform, opts Options) Measurement {
+	m := Measurement{Name: "falltime", Unit: "s"}
+	m.Value, m.Valid = transitionTime(w, opts, false)
+	return m
+}
+
+// Edges returns the crossings of the mid reference level, an edge is only reported once
+// the waveform moved past the hysteresis band on both sides of the level.
+func Edges(w *waveform.Waveform, opts Options) []Edge {
+	amp := Amplitude(w)
+	if !amp.Valid {
+		return nil
+	}
+	base := Base(w).Value
+	level := base + opts.MidRef*amp.Value
+	return Crossings(w, level, opts.Hysteresis*amp.Value)
+}
+
+// Crossings returns the crossings of level, confirmed once the waveform moved past level -/+ hysteresis/2.
+func Crossings(w *waveform.Waveform, level, hysteresis float64) []Edge {
+	result := []Edge{}
+	state := 0
+	cross := Edge{}
+	s := w.Samples
+	for i, v := range s {
+		if i > 0 && (s[i-1] < level) != (v < level) {
+			cross = Edge{Index: i, Time: w.Time(i-1) + (level-s[i-1])/(v-s[i-1])*w.Interval}
+		}
+		if v > level+hysteresis/2 && state != 1 {
+			if state == -1 {
+				cross.Rising = true
+				result = append(result, cross)
+			}
+			state = 1
+		}
+		if v < level-hysteresis/2 && state != -1 {
+			if state == 1 {
+				cross.Rising = false
+				result = append(result, cross)
+			}
+			state = -1
+		}
+	}
+	return result
+}
+
+func averageSpacing(edges []Edge, rising bool) (float64, bool) {
+	var first, last *Edge
+	n := 0
+	for i := range edges {
+		if edges[i].Rising != rising {
+			continue
+		}
+		if first == nil {
+			first = &edges[i]
+		} else {
+			n++
+		}
+		last = &edges[i]
+	}
+	if n == 0 {
+		return 0, false
+	}
+	return (last.Time - first.Time) / float64(n), true
+}
+
+func averageWidth(edges []Edge, rising bool) (float64, bool) {
+	sum, n := 0.0, 0
+	for i := 1; i < len(edges); i++ {
+		if edges[i-1].Rising == rising && edges[i].Rising != rising {
+			sum += edges[i].Time - edges[i-1].Time
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, false
+	}
+	return sum / float64(n), true
+}
+
+func transitionTime(w *waveform.Waveform, opts Options, rising bool) (float64, bool) {
+	amp := Amplitude(w)
+	if !amp.Valid {
+		return 0, false
+	}
+	base := Base(w).Value
+	low, high := base+opts.LowRef*amp.Value, base+opts.HighRef*amp.Value
+	from, to := low, high
+	if !rising {
+		from, to = high, low
+	}
+	sum, n := 0.0, 0
+	for _, e := range Edges(w, opts) {
+		if e.Rising != rising {
+			continue
+		}
+		t0, ok0 := levelTime(w, e.Index, from, -1)
+		t1, ok1 := levelTime(w, e.Index, to, 1)
+		if ok0 && ok1 {
+			sum += t1 - t0
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, false
+	}
+	return sum / float64(n), true
+}
+
+// levelTime searches from index i, backward (dir -1) or forward (dir 1), the interpolated time
+// the waveform crossed level.
+func levelTime(w *waveform.Waveform, i int, level float64, dir int) (float64, bool) {
+	s := w.Samples
+	for j := i; j > 0 && j < len(s); j += dir {
+		a, b := s[j-1], s[j]
+		if (a-level)*(b-level) <= 0 && a != b {
+			return w.Time(j-1) + (level-a)/(b-a)*w.Interval, true
+		}
+	}
+	return 0, false
+}
+
+func mode(w *waveform.Waveform, upper bool) float64 {
+	min, max := Min(w).Value, Max(w).Value
+	if len(w.Samples) == 0 || max == min {
+		return max
+	}
+	bins := make([]int, histogramBins)
+	for _, v := range w.Samples {
+		b := int((v - min) / (max - min) * (histogramBins - 1))
+		bins[b]++
+	}
+	from, to := 0, histogramBins/2
+	if upper {
+		from, to = histogramBins/2, histogramBins
+	}
+	best := from
+	for b := from; b < to; b++ {
+		if bins[b] > bins[best] {
+			best = b
+		}
+	}
+	// without a flat level, such as for a sine, fall back to the extremes
+	if bins[best] < len(w.Samples)/20 {
+		if upper {
+			return max
+		}
+		return min
+	}
+	sum, n := 0.0, 0
+	for _, v := range w.Samples {
+		if int((v-min)/(max-min)*(histogramBins-1)) == best {
+			sum += v
+			n++
+		}
+	}
+	return sum / float64(n)
+}
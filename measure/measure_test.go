@@ -0,0 +1,92 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package measure
+
+import (
+	"github.com/frnckdlprt/hdsctl/waveform"
+	"math"
+	"testing"
+)
+
+// trapezoid wave of 1kHz from 0V to 1V, 25% duty cycle, with 100us linear edges and an overshoot
+func testWave() *waveform.Waveform {
+	w := &waveform.Waveform{Name: "CH1", Unit: "V", Interval: 1e-6}
+	for i := 0; i < 5000; i++ {
+		t := math.Mod(float64(i)*w.Interval, 1e-3)
+		v := 0.0
+		switch {
+		case t < 100e-6:
+			v = t / 100e-6
+		case t < 250e-6:
+			v = 1
+		case t < 350e-6:
+			v = 1 - (t-250e-6)/100e-6
+		}
+		if i%1000 == 100 {
+			v = 1.2
+		}
+		w.Samples = append(w.Samples, v)
+	}
+	return w
+}
+
+func Test_measurements(t *testing.T) {
+	tests := map[string]float64{
+		"max":       1.2,
+		"min":       0,
+		"top":       1,
+		"base":      0,
+		"amplitude": 1,
+		"overshoot": 20,
+		"period":    1e-3,
+		"frequency": 1e3,
+		"+width":    250e-6,
+		"duty":      25,
+		"risetime":  80e-6,
+		"falltime":  80e-6,
+	}
+	for _, m := range Measurements(testWave(), DefaultOptions()) {
+		expected, ok := tests[m.Name]
+		if !ok {
+			continue
+		}
+		tolerance := math.Abs(expected) * 0.02
+		if expected == 0 {
+			tolerance = 1e-3
+		}
+		if !m.Valid || math.Abs(m.Value-expected) > tolerance {
+			t.Errorf("unexpected %s: %v %s (valid=%v), expected %v", m.Name, m.Value, m.Unit, m.Valid, expected)
+		}
+	}
+}
+
+func Test_invalid(t *testing.T) {
+	w := &waveform.Waveform{Unit: "V", Interval: 1e-6, Samples: []float64{0.5, 0.5, 0.5}}
+	if Frequency(w, DefaultOptions()).Valid || RiseTime(w, DefaultOptions()).Valid {
+		t.Fatalf("flat waveform measurements should be invalid")
+	}
+	if m := RMS(w); !m.Valid || m.Value != 0.5 {
+		t.Fatalf("unexpected rms: %v", m)
+	}
+	// no sample
+	w.Samples = nil
+	for _, m := range Measurements(w, DefaultOptions()) {
+		if m.Valid || m.Value != 0 {
+			t.Fatalf("unexpected measurement of an empty waveform: %+v", m)
+		}
+	}
+}
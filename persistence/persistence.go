@@ -0,0 +1,200 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package persistence
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/frnckdlprt/hdsctl"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// the screen spans 8 vertical divisions centered on 0, in raw units
+const screenUnits = 4 * hdsctl.UnitsPerDivision
+
+// magic of the binary stream, followed by the version
+const magic = "HDSP"
+const version = 1
+
+// ChannelColors are the colors of the channels in the heatmap image.
+var ChannelColors = map[int]color.RGBA{
+	1: {R: 255, G: 255, A: 255},
+	2: {G: 128, B: 255, A: 255},
+}
+
+// Persistence accumulates frames as a hit count histogram per channel, of Width time columns
+// by Height voltage rows covering the screen.
+type Persistence struct {
+	Width, Height int
+	// DecayTime is the time constant of the exponential decay of the hits, based on the frame
+	// timestamps, the persistence is infinite when 0.
+	DecayTime time.Duration
+	header    *hdsctl.Header
+	last      time.Time
+	frames    int
+	hits      map[int][]float64
+}
+
+func New(width, height int, decay time.Duration) *Persistence {
+	return &Persistence{Width: width, Height: height, DecayTime: decay, hits: map[int][]float64{}}
+}
+
+// Add accumulates the waves of the frame, and returns true when the previous frames were discarded
+// because the acquisition settings changed.
+func (p *Persistence) Add(frame *hdsctl.Frame) bool {
+	reset := p.header != nil && !p.header.SameSettings(frame.Header)
+	if reset {
+		p.Reset()
+	}
+	if p.DecayTime > 0 && !p.last.IsZero() {
+		k := math.Exp(-float64(frame.Timestamp.Sub(p.last)) / float64(p.DecayTime))
+		for _, hits := range p.hits {
+			for i := range hits {
+				hits[i] *= math.Min(1, k)
+			}
+		}
+	}
+	p.header = frame.Header
+	p.last = frame.Timestamp
+	p.frames++
+	for ch, wave := range frame.Waves {
+		hits, ok := p.hits[ch]
+		if !ok {
+			hits = make([]float64, p.Width*p.Height)
+			p.hits[ch] = hits
+		}
+		prev := -1
+		for i, raw := range wave {
+			x := i * p.Width / len(wave)
+			y := p.row(raw)
+			// vertical segments join consecutive samples, so that fast edges are visible
+			from, to := y, y
+			// the previous sample hit its row already
+			if prev >= 0 && prev < y {
+				from = prev + 1
+			} else if prev > y {
+				to = prev - 1
+			}
+			for r := from; r <= to; r++ {
+				hits[r*p.Width+x]++
+			}
+			prev = y
+		}
+	}
+	return reset
+}
+
+func (p *Persistence) Reset() {
+	p.header = nil
+	p.last = time.Time{}
+	p.frames = 0
+	p.hits = map[int][]float64{}
+}
+
+// Frames returns the number of accumulated frames.
+func (p *Persistence) Frames() int {
+	return p.frames
+}
+
+func (p *Persistence) Channels() []int {
+	result := []int{}
+	for ch := range p.hits {
+		result = append(result, ch)
+	}
+	sort.Ints(result)
+	return result
+}
+
+// Hits returns the hit counts of a channel, row by row from the top of the screen.
+func (p *Persistence) Hits(ch int) []float64 {
+	return p.hits[ch]
+}
+
+// Intensities returns the hit counts of a channel on a logarithmic scale from 0 to 255,
+// so that rare events remain visible next to the frequent ones.
+func (p *Persistence) Intensities(ch int) []uint8 {
+	hits := p.hits[ch]
+	result := make([]uint8, len(hits))
+	top := 0.0
+	for _, h := range hits {
+		top = math.Max(top, h)
+	}
+	if top == 0 {
+		return result
+	}
+	for i, h := range hits {
+		result[i] = uint8(math.Round(255 * math.Log1p(h) / math.Log1p(top)))
+	}
+	return result
+}
+
+// Image renders the intensities of every channel in its color over a black background.
+func (p *Persistence) Image() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, p.Width, p.Height))
+	sums := make([][3]float64, p.Width*p.Height)
+	for _, ch := range p.Channels() {
+		c, ok := ChannelColors[ch]
+		if !ok {
+			c = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+		}
+		for i, v := range p.Intensities(ch) {
+			sums[i][0] += float64(c.R) * float64(v) / 255
+			sums[i][1] += float64(c.G) * float64(v) / 255
+			sums[i][2] += float64(c.B) * float64(v) / 255
+		}
+	}
+	for i, s := range sums {
+		img.SetRGBA(i%p.Width, i/p.Width, color.RGBA{R: clamp(s[0]), G: clamp(s[1]), B: clamp(s[2]), A: 255})
+	}
+	return img
+}
+
+// WriteBinary writes the intensities as a compact stream: the HDSP magic, a version byte, the width and
+// height as uint16 little endian, the channel count, then for each channel its number and its
+// width x height intensities, row by row from the top of the screen.
+func (p *Persistence) WriteBinary(w io.Writer) error {
+	channels := p.Channels()
+	head := []byte(magic)
+	head = append(head, version)
+	head = binary.LittleEndian.AppendUint16(head, uint16(p.Width))
+	head = binary.LittleEndian.AppendUint16(head, uint16(p.Height))
+	head = append(head, byte(len(channels)))
+	if _, err := w.Write(head); err != nil {
+		return fmt.Errorf("failed to write persistence: %w", err)
+	}
+	for _, ch := range channels {
+		if _, err := w.Write(append([]byte{byte(ch)}, p.Intensities(ch)...)); err != nil {
+			return fmt.Errorf("failed to write persistence: %w", err)
+		}
+	}
+	return nil
+}
+
+// row returns the histogram row of a raw sample, clamped to the screen
+func (p *Persistence) row(raw int8) int {
+	v := math.Max(-screenUnits, math.Min(screenUnits, float64(raw)))
+	return int(math.Round((screenUnits - v) / (2 * screenUnits) * float64(p.Height-1)))
+}
+
+func clamp(v float64) uint8 {
+	return uint8(math.Min(255, math.Round(v)))
+}
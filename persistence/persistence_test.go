@@ -0,0 +1,78 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package persistence
+
+import (
+	"bytes"
+	"github.com/frnckdlprt/hdsctl"
+	"math"
+	"testing"
+	"time"
+)
+
+func flatFrame(header *hdsctl.Header, ts time.Time, raw int8) *hdsctl.Frame {
+	wave := make([]int8, 300)
+	for i := range wave {
+		wave[i] = raw
+	}
+	return &hdsctl.Frame{Header: header, Timestamp: ts, Waves: map[int][]int8{1: wave}}
+}
+
+func Test_persistence(t *testing.T) {
+	header := &hdsctl.Header{}
+	ts := time.Now()
+	p := New(100, 201, 0)
+	p.Add(flatFrame(header, ts, 0))
+	p.Add(flatFrame(header, ts, 0))
+	p.Add(flatFrame(header, ts, 100))
+	hits := p.Hits(1)
+	// 3 samples per column, the middle row is 100
+	if p.Frames() != 3 || hits[100*100] != 6 || hits[0] != 3 || hits[200*100] != 0 {
+		t.Fatalf("unexpected hits: %v %v %v", hits[100*100], hits[0], hits[200*100])
+	}
+	in := p.Intensities(1)
+	if in[100*100] != 255 || in[0] == 0 || in[0] >= 255 {
+		t.Fatalf("unexpected intensities: %v %v", in[100*100], in[0])
+	}
+	if c := p.Image().RGBAAt(0, 100); c.R != 255 || c.G != 255 || c.B != 0 {
+		t.Fatalf("unexpected color: %v", c)
+	}
+	b := &bytes.Buffer{}
+	if err := p.WriteBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if b.Len() != 10+1+100*201 || b.String()[:4] != "HDSP" {
+		t.Fatalf("unexpected binary stream: %v bytes", b.Len())
+	}
+	// a scale change discards the accumulated frames
+	other := &hdsctl.Header{Channels: []hdsctl.HeaderChannel{{Scale: "1V"}}}
+	if !p.Add(flatFrame(other, ts, 0)) || p.Frames() != 1 {
+		t.Fatalf("persistence not reset: %v frames", p.Frames())
+	}
+}
+
+func Test_persistenceDecay(t *testing.T) {
+	header := &hdsctl.Header{}
+	ts := time.Now()
+	p := New(100, 201, time.Second)
+	p.Add(flatFrame(header, ts, 0))
+	p.Add(flatFrame(header, ts.Add(time.Second), 50))
+	hits := p.Hits(1)
+	if math.Abs(hits[100*100]-3/math.E) > 1e-9 || hits[50*100] != 3 {
+		t.Fatalf("unexpected decayed hits: %v %v", hits[100*100], hits[50*100])
+	}
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hdsctl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const defaultRecordTimeout = 10 * time.Second
+
+type RecordOptions struct {
+	// maximum number of frames, 0 for no limit
+	Count int
+	// maximum recording time, 0 for no limit
+	Duration time.Duration
+	// minimum time between two captures
+	Interval time.Duration
+	// time to wait for a trigger before re-arming
+	Timeout time.Duration
+}
+
+// Record repeatedly captures single shot frames and passes them to fn, until the count or duration
+// is reached or ctx is done. It returns the number of recorded frames.
+func (hds *HDS) Record(ctx context.Context, opts RecordOptions, fn func(frame *Frame) error) (count int, err error) {
+	if opts.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Duration)
+		defer cancel()
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultRecordTimeout
+	}
+	for opts.Count <= 0 || count < opts.Count {
+		t0 := time.Now()
+		frame, err := hds.Capture(ctx, opts.Timeout)
+		if errors.Is(err, ErrTriggerTimeout) {
+			continue
+		}
+		if ctx.Err() != nil {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+		if err := fn(frame); err != nil {
+			return count, err
+		}
+		count++
+		select {
+		case <-ctx.Done():
+			return count, nil
+		case <-time.After(time.Until(t0.Add(opts.Interval))):
+		}
+	}
+	return count, nil
+}
+
+// SegmentWriter writes frames to a segment file, one json frame per line.
+type SegmentWriter struct {
+	enc *json.Encoder
+}
+
+func NewSegmentWriter(w io.Writer) *SegmentWriter {
+	return &SegmentWriter{enc: json.NewEncoder(w)}
+}
+
+func (sw *SegmentWriter) Write(frame *Frame) error {
+	if err := sw.enc.Encode(frame); err != nil {
+		return fmt.Errorf("failed to write frame %v: %w", frame.Seq, err)
+	}
+	return nil
+}
+
+type SegmentReader struct {
+	dec *json.Decoder
+}
+
+func NewSegmentReader(r io.Reader) *SegmentReader {
+	return &SegmentReader{dec: json.NewDecoder(r)}
+}
+
+// Next returns the next recorded frame, or io.EOF at the end of the segment file.
+func (sr *SegmentReader) Next() (frame *Frame, err error) {
+	frame = &Frame{}
+	if err := sr.dec.Decode(frame); err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to read frame: %w", err)
+	}
+	return frame, nil
+}
+
+// ReadSegments calls fn for every frame of a segment file.
+func ReadSegments(r io.Reader, fn func(frame *Frame) error) error {
+	sr := NewSegmentReader(r)
+	for {
+		frame, err := sr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(frame); err != nil {
+			return err
+		}
+	}
+}
@@ -17,13 +17,24 @@ limitations under the License.
 package scpi
 
 import (
+	"encoding/json"
 	"fmt"
 	"math"
 	"strconv"
+	"strings"
+	"sync"
 )
 
 type MockExecutor struct {
+	// commands are executed one at a time, as by the usb executor
+	mx     sync.Mutex
 	values map[string][]byte
+	// NoTrigger keeps the armed scope waiting, otherwise it triggers before the first status read
+	NoTrigger bool
+	// Lagging reports the trigger status from before the last sweep mode change once, as a scope
+	// that did not process the change yet
+	Lagging bool
+	stale   []byte
 }
 
 func NewMockExecutor() *MockExecutor {
@@ -31,19 +42,45 @@ func NewMockExecutor() *MockExecutor {
 	result.values[":CH1:OFFSet"] = []byte("0")
 	result.values[":CH1:DISPlay"] = []byte("ON")
 	result.values[":CH2:DISPlay"] = []byte("OFF")
+	result.values[":CH2:OFFSet"] = []byte("0")
+	result.values[":CH1:SCALe"] = []byte("1.00V")
+	result.values[":CH2:SCALe"] = []byte("1.00V")
+	result.values[":HORizontal:SCALe"] = []byte("100us")
+	result.values[":TRIGger:SINGle:SWEep"] = []byte("AUTO")
+	result.values[":TRIGger:STATus"] = []byte("AUTO")
+	result.values[":DMM:CONFigure:VOLTage"] = []byte("DC")
+	result.values[":DMM:REL"] = []byte("OFF")
+	result.values[":DMM:MEAS"] = []byte("1.234mV")
+	result.values[":FUNCtion"] = []byte("SINE")
+	result.values[":CHANnel"] = []byte("OFF")
+	result.setAWG(1000, 2, 0)
 	return result
 }
 
 func (me *MockExecutor) Execute(cmd Command) (result []byte, err error) {
-	if cmd.Definition.Name == ":DATa:WAVe:SCReen:CH1" {
+	me.mx.Lock()
+	defer me.mx.Unlock()
+	if cmd.Definition.Name == ":DATa:WAVe:SCReen:HEAD" {
+		return me.header()
+	}
+	if strings.HasPrefix(cmd.Definition.Name, ":DATa:WAVe:SCReen:CH") {
+		ch := strings.TrimPrefix(cmd.Definition.Name, ":DATa:WAVe:SCReen:")
 		result = []byte{0, 0, 0, 0}
-		offsb, _ := me.values[":CH1:OFFSet"]
+		offsb, _ := me.values[fmt.Sprintf(":%s:OFFSet", ch)]
 		var offs int64
 		if s, err := strconv.ParseFloat(string(offsb), 32); err == nil {
 			offs = int64(s * 25.0)
 		}
+		phase := 0.0
+		if ch == "CH2" {
+			phase = math.Pi / 2
+		}
+		awg := me.awgSignal(ch)
 		for i := 0; i < 300; i++ {
-			j := offs + int64(100*math.Sin(float64(i)/50))
+			j := offs + int64(100*math.Sin(float64(i)/50+phase))
+			if awg != nil {
+				j = offs + int64(math.Round(awg(i)))
+			}
 			if j <= -127 {
 				j = -127
 			}
@@ -55,6 +92,11 @@ func (me *MockExecutor) Execute(cmd Command) (result []byte, err error) {
 		return result, nil
 	}
 	//fmt.Printf("mock exec: %v %v\n", cmd.Definition.Name, cmd.Arguments)
+	if cmd.Definition.Name == ":TRIGger:STATus" && len(cmd.Arguments) == 0 && me.stale != nil {
+		stale := me.stale
+		me.stale = nil
+		return stale, nil
+	}
 	if len(cmd.Arguments) == 0 {
 		v, ok := me.values[cmd.Definition.Name]
 		if !ok {
@@ -62,6 +104,166 @@ func (me *MockExecutor) Execute(cmd Command) (result []byte, err error) {
 		}
 		return v, nil
 	}
+	if me.awg(cmd.Definition.Name, cmd.Arguments[0]) {
+		return nil, nil
+	}
 	me.values[cmd.Definition.Name] = []byte(cmd.Arguments[0])
+	if cmd.Definition.Name == ":TRIGger:SINGle:SWEep" {
+		if me.Lagging {
+			me.stale = me.values[":TRIGger:STATus"]
+		}
+		status := "AUTO"
+		if cmd.Arguments[0] == "SINGle" {
+			status = "TRIG"
+			if me.NoTrigger {
+				status = "READY"
+			}
+		}
+		me.values[":TRIGger:STATus"] = []byte(status)
+	}
 	return nil, nil
 }
+
+// awg sets the generator levels and frequency, which the firmware takes in volts and hertz but
+// reports in millivolts and microhertz, and keeps amplitude and offset consistent with high and low
+func (me *MockExecutor) awg(name, arg string) bool {
+	v, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return false
+	}
+	value := func(name string, scale float64) float64 {
+		f, _ := strconv.ParseFloat(string(me.values[name]), 64)
+		return f * scale
+	}
+	freq := value(":FUNCtion:FREQuency", 1e-6)
+	ampl, offs := value(":FUNCtion:AMPLitude", 1e-3), value(":FUNCtion:OFFSet", 1e-3)
+	high, low := offs+ampl/2, offs-ampl/2
+	switch name {
+	case ":FUNCtion:FREQuency":
+		freq = v
+	case ":FUNCtion:AMPLitude":
+		ampl = v
+	case ":FUNCtion:OFFSet":
+		offs = v
+	case ":FUNCtion:HIGHt":
+		ampl, offs = v-low, (v+low)/2
+	case ":FUNCtion:LOW":
+		ampl, offs = high-v, (high+v)/2
+	default:
+		return false
+	}
+	me.setAWG(freq, ampl, offs)
+	return true
+}
+
+// mockLowPassCutoff is the cutoff frequency of the first order low pass filter between the
+// generator, probed by CH1, and CH2
+const mockLowPassCutoff = 1000.0
+
+// awgSignal returns the raw samples of the channel when the generator output is on, nil otherwise
+func (me *MockExecutor) awgSignal(ch string) func(i int) float64 {
+	if string(me.values[":CHANnel"]) != "ON" {
+		return nil
+	}
+	value := func(name string, scale float64) float64 {
+		f, _ := strconv.ParseFloat(string(me.values[name]), 64)
+		return f * scale
+	}
+	freq := value(":FUNCtion:FREQuency", 1e-6)
+	ampl, offs := value(":FUNCtion:AMPLitude", 1e-3), value(":FUNCtion:OFFSet", 1e-3)
+	gain, phase := 1.0, 0.0
+	if ch == "CH2" {
+		gain, phase = 1/math.Hypot(1, freq/mockLowPassCutoff), -math.Atan(freq/mockLowPassCutoff)
+	}
+	dt := mockValue(string(me.values[":HORizontal:SCALe"])) * 12 / 300
+	vpu := mockValue(string(me.values[fmt.Sprintf(":%s:SCALe", ch)])) / 25
+	if string(me.values[":FUNCtion"]) == "SQUare" {
+		// steady state of the filter, which starts each half period from where the previous one ended
+		tau := 1 / (2 * math.Pi * mockLowPassCutoff)
+		k := math.Exp(-0.5 / freq / tau)
+		return func(i int) float64 {
+			t := math.Mod(float64(i)*dt*freq, 1)
+			level, from, elapsed := ampl/2, -ampl/2*(1-k)/(1+k), t/freq
+			if t >= 0.5 {
+				level, from, elapsed = -level, -from, (t-0.5)/freq
+			}
+			if ch == "CH1" {
+				return (offs + level) / vpu
+			}
+			return (offs + level + (from-level)*math.Exp(-elapsed/tau)) / vpu
+		}
+	}
+	return func(i int) float64 {
+		return (offs + gain*ampl/2*math.Sin(2*math.Pi*freq*float64(i)*dt+phase)) / vpu
+	}
+}
+
+// mockValue parses values such as "500mV" or "1.0ms" in base units
+func mockValue(s string) float64 {
+	s = strings.TrimRight(s, "Vs")
+	scale := 1.0
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'n':
+			scale = 1e-9
+		case 'u':
+			scale = 1e-6
+		case 'm':
+			scale = 1e-3
+		case 'k':
+			scale = 1e3
+		}
+		if scale != 1 {
+			s = s[:n-1]
+		}
+	}
+	v, _ := strconv.ParseFloat(s, 64)
+	return v * scale
+}
+
+func (me *MockExecutor) setAWG(freq, ampl, offs float64) {
+	format := func(v float64) []byte {
+		return []byte(strconv.FormatFloat(math.Round(v), 'f', -1, 64))
+	}
+	me.values[":FUNCtion:FREQuency"] = format(freq * 1e6)
+	me.values[":FUNCtion:AMPLitude"] = format(ampl * 1e3)
+	me.values[":FUNCtion:OFFSet"] = format(offs * 1e3)
+	me.values[":FUNCtion:HIGHt"] = format((offs + ampl/2) * 1e3)
+	me.values[":FUNCtion:LOW"] = format((offs - ampl/2) * 1e3)
+}
+
+func (me *MockExecutor) header() (result []byte, err error) {
+	channels := []map[string]interface{}{}
+	for _, ch := range []string{"CH1", "CH2"} {
+		offs, _ := strconv.ParseFloat(string(me.values[fmt.Sprintf(":%s:OFFSet", ch)]), 64)
+		channels = append(channels, map[string]interface{}{
+			"NAME":     ch,
+			"DISPLAY":  string(me.values[fmt.Sprintf(":%s:DISPlay", ch)]),
+			"COUPLING": "DC",
+			"PROBE":    "1X",
+			"SCALE":    string(me.values[fmt.Sprintf(":%s:SCALe", ch)]),
+			"OFFSET":   offs * 25,
+		})
+	}
+	header := map[string]interface{}{
+		"TIMEBASE": map[string]interface{}{"SCALE": string(me.values[":HORizontal:SCALe"]), "HOFFSET": 0},
+		"SAMPLE": map[string]interface{}{
+			"FULLSCREEN": 300,
+			"DATALEN":    300,
+			"SAMPLERATE": "250kSa/s",
+			"TYPE":       "SAMPle",
+			"DEPMEM":     "4K",
+		},
+		"CHANNEL":   channels,
+		"DATATYPE":  "SCREEN",
+		"RUNSTATUS": "TRIG",
+		"IDN":       "mock",
+		"MODEL":     "HDS272S_1",
+		"Trig": map[string]interface{}{
+			"Mode":  "SINGle",
+			"Type":  "Edge",
+			"Items": map[string]interface{}{"Channel": "CH1", "Level": "0.00V", "Edge": "RISE", "Coupling": "DC", "Sweep": "AUTO"},
+		},
+	}
+	return json.Marshal(header)
+}
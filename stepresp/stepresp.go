@@ -0,0 +1,166 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stepresp
+
+import (
+	"fmt"
+	"github.com/frnckdlprt/hdsctl/measure"
+	"github.com/frnckdlprt/hdsctl/waveform"
+	"math"
+)
+
+// fraction of a half period averaged as the level before and after an edge
+const levelWindow = 0.1
+
+type Options struct {
+	// settling band around the final level, as a fraction of the step
+	Tolerance float64
+	// rise time reference levels, as fractions of the step
+	LowRef  float64
+	HighRef float64
+	// expected gain from the reference to the response, the steady state error being measured against it
+	Gain float64
+}
+
+func DefaultOptions() Options {
+	return Options{Tolerance: 0.02, LowRef: 0.1, HighRef: 0.9, Gain: 1}
+}
+
+// Edge is the response to an edge of the reference, times being relative to the reference edge
+type Edge struct {
+	Time      float64 `json:"time"`
+	Rising    bool    `json:"rising"`
+	Initial   float64 `json:"initial"`
+	Final     float64 `json:"final"`
+	Delay     float64 `json:"delay"`
+	RiseTime  float64 `json:"riseTime"`
+	Overshoot float64 `json:"overshoot"`
+	// settling time, valid when the response settled before the end of the half period
+	Settling float64 `json:"settling"`
+	Settled  bool    `json:"settled"`
+	// final level minus the reference one times the gain, in volts and in percent of the expected step
+	Error        float64 `json:"error"`
+	ErrorPercent float64 `json:"errorPercent"`
+}
+
+// Analyze measures the response to every edge of the reference followed by another edge, so that
+// the response has a whole half period to settle
+func Analyze(ref, resp *waveform.Waveform, opts Options) ([]Edge, error) {
+	if len(ref.Samples) != len(resp.Samples) || ref.Interval != resp.Interval {
+		return nil, fmt.Errorf("reference %s and response %s are not sampled alike", ref.Name, resp.Name)
+	}
+	edges := measure.Edges(ref, measure.DefaultOptions())
+	result := []Edge{}
+	for k := 0; k+1 < len(edges); k++ {
+		from, to := edges[k].Index, edges[k+1].Index
+		n := int(math.Ceil(float64(to-from) * levelWindow))
+		if from-n < 0 || n < 1 {
+			continue
+		}
+		e := Edge{Time: edges[k].Time, Rising: edges[k].Rising}
+		e.Initial = mean(resp.Samples[from-n : from])
+		e.Final = mean(resp.Samples[to-n : to])
+		refStep := mean(ref.Samples[to-n:to]) - mean(ref.Samples[from-n:from])
+		step := e.Final - e.Initial
+		// the response has no step to measure
+		if math.Abs(step) < math.Abs(refStep*opts.Gain)*opts.Tolerance {
+			continue
+		}
+		sign := math.Copysign(1, step)
+		low, lok := crossing(resp, from, to, e.Initial+opts.LowRef*step, sign)
+		high, hok := crossing(resp, from, to, e.Initial+opts.HighRef*step, sign)
+		if !lok || !hok {
+			continue
+		}
+		mid, _ := crossing(resp, from, to, e.Initial+step/2, sign)
+		e.Delay = mid - e.Time
+		e.RiseTime = high - low
+		peak := 0.0
+		last := -1
+		for i := from; i < to; i++ {
+			peak = math.Max(peak, (resp.Samples[i]-e.Final)*sign)
+			if math.Abs(resp.Samples[i]-e.Final) > opts.Tolerance*math.Abs(step) {
+				last = i
+			}
+		}
+		e.Overshoot = peak / math.Abs(step) * 100
+		e.Settled = last < to-n
+		if e.Settled {
+			e.Settling = math.Max(0, resp.Time(last+1)-e.Time)
+		}
+		expected := opts.Gain * mean(ref.Samples[to-n:to])
+		e.Error = e.Final - expected
+		e.ErrorPercent = e.Error / math.Abs(opts.Gain*refStep) * 100
+		result = append(result, e)
+	}
+	return result, nil
+}
+
+// Summarize averages the edge measurements, the settling time over the edges that settled; the steady
+// state error is signed as the step, negative when the response falls short of the expected level
+func Summarize(edges []Edge) []measure.Measurement {
+	avg := func(name, unit string, value func(e Edge) (float64, bool)) measure.Measurement {
+		m := measure.Measurement{Name: name, Unit: unit}
+		n := 0
+		for _, e := range edges {
+			if v, ok := value(e); ok {
+				m.Value += v
+				n++
+			}
+		}
+		if n > 0 {
+			m.Value /= float64(n)
+			m.Valid = true
+		}
+		return m
+	}
+	settled := 0
+	for _, e := range edges {
+		if e.Settled {
+			settled++
+		}
+	}
+	return []measure.Measurement{
+		{Name: "edges", Value: float64(len(edges)), Valid: true},
+		{Name: "settled", Value: float64(settled), Valid: true},
+		avg("delay", "s", func(e Edge) (float64, bool) { return e.Delay, true }),
+		avg("risetime", "s", func(e Edge) (float64, bool) { return e.RiseTime, true }),
+		avg("overshoot", "%", func(e Edge) (float64, bool) { return e.Overshoot, true }),
+		avg("settling", "s", func(e Edge) (float64, bool) { return e.Settling, e.Settled }),
+		avg("sserror", "V", func(e Edge) (float64, bool) { return e.Error * math.Copysign(1, e.Final-e.Initial), true }),
+		avg("sserror%", "%", func(e Edge) (float64, bool) { return e.ErrorPercent * math.Copysign(1, e.Final-e.Initial), true }),
+	}
+}
+
+// crossing returns the interpolated time the waveform first crosses level in the direction of sign
+func crossing(w *waveform.Waveform, from, to int, level, sign float64) (float64, bool) {
+	for i := from; i < to; i++ {
+		a, b := (w.Samples[i-1]-level)*sign, (w.Samples[i]-level)*sign
+		if a < 0 && b >= 0 {
+			return w.Time(i-1) + a/(a-b)*w.Interval, true
+		}
+	}
+	return 0, false
+}
+
+func mean(s []float64) float64 {
+	sum := 0.0
+	for _, v := range s {
+		sum += v
+	}
+	return sum / float64(len(s))
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stepresp
+
+import (
+	"github.com/frnckdlprt/hdsctl/measure"
+	"github.com/frnckdlprt/hdsctl/waveform"
+	"math"
+	"testing"
+)
+
+// square reference of 500Hz from 0V to 1V, with 4 edges, and its response through a system of the given step response
+func testWaves(response func(t float64) float64) (ref, resp *waveform.Waveform) {
+	ref = &waveform.Waveform{Name: "CH1", Unit: "V", Interval: 1e-6}
+	resp = &waveform.Waveform{Name: "CH2", Unit: "V", Interval: 1e-6}
+	for i := 0; i < 5000; i++ {
+		t := float64(i) * ref.Interval
+		half := math.Mod(t, 1e-3)
+		high := math.Mod(t, 2e-3) < 1e-3
+		v := 0.0
+		if high {
+			v = 1
+		}
+		ref.Samples = append(ref.Samples, v)
+		// the previous half period ended settled, so that each edge restarts from a steady level
+		r := response(half)
+		if !high {
+			r = response(1) - r
+		}
+		resp.Samples = append(resp.Samples, r)
+	}
+	return ref, resp
+}
+
+func values(ms []measure.Measurement) map[string]float64 {
+	result := map[string]float64{}
+	for _, m := range ms {
+		if m.Valid {
+			result[m.Name] = m.Value
+		}
+	}
+	return result
+}
+
+func Test_firstOrder(t *testing.T) {
+	tau := 50e-6
+	ref, resp := testWaves(func(t float64) float64 { return 0.95 * (1 - math.Exp(-t/tau)) })
+	edges, err := Analyze(ref, resp, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := values(Summarize(edges))
+	expected := map[string]float64{
+		"edges":     3,
+		"settled":   3,
+		"delay":     tau * math.Ln2,
+		"risetime":  tau * math.Log(9),
+		"overshoot": 0,
+		"settling":  tau * math.Log(50),
+		"sserror%":  -5.0 / 3,
+	}
+	for k, v := range expected {
+		if math.Abs(m[k]-v) > math.Max(math.Abs(v)*0.03, 1e-6) {
+			t.Errorf("unexpected %s: %v, expected %v", k, m[k], v)
+		}
+	}
+	// the gain error shows at the high level only, reached by the rising edge
+	if edges[0].Rising || math.Abs(edges[0].Error) > 1e-3 || !edges[1].Rising || math.Abs(edges[1].ErrorPercent+5) > 0.1 {
+		t.Fatalf("unexpected steady state errors: %+v", edges[:2])
+	}
+}
+
+func Test_overshoot(t *testing.T) {
+	// second order system with a 0.5 damping ratio, overshooting by 16.3%
+	zeta, wn := 0.5, 2*math.Pi*10e3
+	wd := wn * math.Sqrt(1-zeta*zeta)
+	ref, resp := testWaves(func(t float64) float64 {
+		return 1 - math.Exp(-zeta*wn*t)*(math.Cos(wd*t)+zeta/math.Sqrt(1-zeta*zeta)*math.Sin(wd*t))
+	})
+	edges, err := Analyze(ref, resp, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := values(Summarize(edges))
+	overshoot := 100 * math.Exp(-math.Pi*zeta/math.Sqrt(1-zeta*zeta))
+	if math.Abs(m["overshoot"]-overshoot) > 0.2 || math.Abs(m["sserror%"]) > 0.1 || m["settled"] != 3 {
+		t.Fatalf("unexpected measurements: %v, expected an overshoot of %.1f%%", m, overshoot)
+	}
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sweep
+
+import (
+	"context"
+	"fmt"
+	"github.com/frnckdlprt/hdsctl"
+	"github.com/frnckdlprt/hdsctl/datalog"
+	"math"
+	"time"
+)
+
+// Parameter is the generator setting stepped by a sweep
+type Parameter string
+
+const (
+	Frequency Parameter = "frequency"
+	Amplitude Parameter = "amplitude"
+)
+
+func ParseParameter(s string) (Parameter, error) {
+	switch Parameter(s) {
+	case Frequency, Amplitude:
+		return Parameter(s), nil
+	}
+	return "", fmt.Errorf("invalid sweep parameter: %s", s)
+}
+
+type Options struct {
+	Parameter Parameter
+	// first and last values, in hertz or volts peak to peak
+	Start float64
+	Stop  float64
+	// number of values, start and stop included
+	Steps int
+	// logarithmic rather than linear spacing of the values
+	Log bool
+	// time to let the circuit settle after each step, before capturing or measuring
+	Dwell time.Duration
+	// acquires a frame at each step
+	Capture bool
+	// fields measured at each step: field ids, or scpi queries such as :MEASurement:CH1:PKPK
+	Fields []string
+}
+
+// Step is the result of a sweep step, Index counting from 0 up to Total-1
+type Step struct {
+	Index  int               `json:"index"`
+	Total  int               `json:"total"`
+	Value  float64           `json:"value"`
+	Time   time.Time         `json:"time"`
+	Frame  *hdsctl.Frame     `json:"-"`
+	Values map[string]string `json:"values,omitempty"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// Points returns n values from start to stop, evenly spaced on a linear or logarithmic scale
+func Points(start, stop float64, n int, log bool) ([]float64, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("invalid number of steps: %v", n)
+	}
+	if log && (start <= 0 || stop <= 0) {
+		return nil, fmt.Errorf("invalid log sweep from %v to %v: values must be positive", start, stop)
+	}
+	if n == 1 {
+		return []float64{start}, nil
+	}
+	result := make([]float64, n)
+	for i := range result {
+		x := float64(i) / float64(n-1)
+		if log {
+			result[i] = start * math.Pow(stop/start, x)
+		} else {
+			result[i] = start + (stop-start)*x
+		}
+	}
+	return result, nil
+}
+
+// Run steps the generator frequency or amplitude, and after the dwell time of each step acquires a frame
+// and measures the fields, as configured, then passes the step to fn. It returns the number of steps
+// done, with the context error when ctx is done before the end of the sweep.
+func Run(ctx context.Context, hds *hdsctl.HDS, opts Options, fn func(step *Step) error) (count int, err error) {
+	values, err := Points(opts.Start, opts.Stop, opts.Steps, opts.Log)
+	if err != nil {
+		return 0, err
+	}
+	gen := hdsctl.NewGenerator(hds)
+	set := gen.SetFrequency
+	switch opts.Parameter {
+	case Frequency:
+	case Amplitude:
+		set = gen.SetAmplitude
+	default:
+		return 0, fmt.Errorf("invalid sweep parameter: %s", opts.Parameter)
+	}
+	for i, v := range values {
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+		if err := set(v); err != nil {
+			return count, err
+		}
+		select {
+		case <-ctx.Done():
+			return count, ctx.Err()
+		case <-time.After(opts.Dwell):
+		}
+		step := &Step{Index: i, Total: len(values), Value: v, Time: time.Now()}
+		if opts.Capture {
+			if step.Frame, err = hds.Acquire(); err != nil {
+				return count, fmt.Errorf("failed to acquire step %v: %w", i, err)
+			}
+		}
+		for _, f := range opts.Fields {
+			if step.Values == nil {
+				step.Values = map[string]string{}
+			}
+			v, err := datalog.Sample(hds, f)
+			if err != nil {
+				if step.Errors == nil {
+					step.Errors = map[string]string{}
+				}
+				step.Errors[f] = err.Error()
+				continue
+			}
+			step.Values[f] = v
+		}
+		if err := fn(step); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
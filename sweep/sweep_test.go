@@ -0,0 +1,81 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sweep
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/frnckdlprt/hdsctl"
+	"github.com/frnckdlprt/hdsctl/scpi"
+	"testing"
+)
+
+func Test_points(t *testing.T) {
+	lin, err := Points(1, 2, 5, false)
+	if err != nil || fmt.Sprint(lin) != "[1 1.25 1.5 1.75 2]" {
+		t.Fatalf("unexpected linear points: %v %v", lin, err)
+	}
+	log, err := Points(10, 10000, 4, true)
+	if err != nil || fmt.Sprintf("%.6g", log) != "[10 100 1000 10000]" {
+		t.Fatalf("unexpected log points: %v %v", log, err)
+	}
+	if _, err := Points(0, 10, 4, true); err == nil {
+		t.Fatal("expected an error for a log sweep from 0")
+	}
+}
+
+func Test_run(t *testing.T) {
+	hds := hdsctl.NewHDS(scpi.NewHDSClient(scpi.NewMockExecutor()))
+	gen := hdsctl.NewGenerator(hds)
+	opts := Options{Parameter: Frequency, Start: 100, Stop: 10000, Steps: 3, Log: true, Capture: true, Fields: []string{":FUNCtion:FREQuency"}}
+	freqs := []string{}
+	n, err := Run(context.Background(), hds, opts, func(step *Step) error {
+		hz, err := gen.Frequency()
+		if err != nil {
+			return err
+		}
+		if step.Frame == nil || step.Total != 3 || hz != step.Value {
+			t.Fatalf("unexpected step: %+v at %v Hz", step, hz)
+		}
+		freqs = append(freqs, step.Values[":FUNCtion:FREQuency"])
+		return nil
+	})
+	if err != nil || n != 3 {
+		t.Fatalf("unexpected sweep of %v steps: %v", n, err)
+	}
+	// the firmware reports microhertz
+	if fmt.Sprint(freqs) != "[100000000 1000000000 10000000000]" {
+		t.Fatalf("unexpected measured frequencies: %v", freqs)
+	}
+	// cancelling from the progress callback stops the sweep
+	ctx, cancel := context.WithCancel(context.Background())
+	opts = Options{Parameter: Amplitude, Start: 1, Stop: 2, Steps: 5}
+	n, err = Run(ctx, hds, opts, func(step *Step) error {
+		if step.Index == 1 {
+			cancel()
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) || n != 2 {
+		t.Fatalf("unexpected cancelled sweep of %v steps: %v", n, err)
+	}
+	ampl, err := gen.Amplitude()
+	if err != nil || ampl != 1.25 {
+		t.Fatalf("unexpected amplitude: %v %v", ampl, err)
+	}
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hdsctl
+
+import (
+	"fmt"
+)
+
+// FitTimeBase sets the smallest time base showing at least the given number of periods of the
+// frequency, or the largest one when none does
+func (hds *HDS) FitTimeBase(hz, periods float64) error {
+	if hz <= 0 || periods <= 0 {
+		return fmt.Errorf("invalid time base fit: %v periods of %v Hz", periods, hz)
+	}
+	cd := hds.Client.GetCommandDefinitionByName(":HORizontal:SCALe")
+	if cd == nil || len(cd.ValueRange) == 0 {
+		return fmt.Errorf("no range for the time base")
+	}
+	fit, fitValue, largest, largestValue := "", 0.0, "", 0.0
+	for _, s := range cd.ValueRange {
+		v, _, err := ParseValue(s)
+		if err != nil {
+			return err
+		}
+		if v*HorizontalDivisions*hz >= periods && (fit == "" || v < fitValue) {
+			fit, fitValue = s, v
+		}
+		if v > largestValue {
+			largest, largestValue = s, v
+		}
+	}
+	if fit == "" {
+		fit = largest
+	}
+	if err := hds.Client.Set(":HORizontal:SCALe " + fit); err != nil {
+		return fmt.Errorf("failed to set time base: %w", err)
+	}
+	return nil
+}
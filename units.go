@@ -0,0 +1,79 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hdsctl
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var siPrefixes = map[byte]float64{
+	'p': 1e-12,
+	'n': 1e-9,
+	'u': 1e-6,
+	'm': 1e-3,
+	'k': 1e3,
+	'M': 1e6,
+	'G': 1e9,
+}
+
+// ParseValue parses values as reported by the scope, such as "20ns", "1.00kV" or "250MSa/s",
+// and returns the value in base units along with the unit itself.
+func ParseValue(s string) (v float64, unit string, err error) {
+	s = strings.TrimSpace(s)
+	i := 0
+	for i < len(s) && strings.ContainsRune("0123456789.+-", rune(s[i])) {
+		i++
+	}
+	v, err = strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid value: %s", s)
+	}
+	unit = s[i:]
+	if len(unit) > 1 {
+		if m, ok := siPrefixes[unit[0]]; ok {
+			v *= m
+			unit = unit[1:]
+		}
+	}
+	return v, unit, nil
+}
+
+// FormatValue formats a value with the SI prefix making its mantissa between 1 and 1000
+func FormatValue(v float64, unit string) string {
+	prefixes := []struct {
+		prefix string
+		factor float64
+	}{{"G", 1e9}, {"M", 1e6}, {"k", 1e3}, {"", 1}, {"m", 1e-3}, {"u", 1e-6}, {"n", 1e-9}, {"p", 1e-12}}
+	for _, p := range prefixes {
+		if math.Abs(v) >= p.factor {
+			return fmt.Sprintf("%.4g%s%s", v/p.factor, p.prefix, unit)
+		}
+	}
+	return fmt.Sprintf("%.4g%s", v, unit)
+}
+
+// ParseProbe returns the attenuation factor of a probe setting such as "10X".
+func ParseProbe(s string) (factor float64, err error) {
+	factor, err = strconv.ParseFloat(strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "X"), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid probe: %s", s)
+	}
+	return factor, nil
+}
@@ -0,0 +1,34 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package waveform
+
+// Waveform is a channel converted to physical units, sampled at a fixed interval.
+type Waveform struct {
+	Name     string    `json:"name"`
+	Unit     string    `json:"unit"`
+	Start    float64   `json:"start"`
+	Interval float64   `json:"interval"`
+	Samples  []float64 `json:"samples"`
+}
+
+func (w *Waveform) Time(i int) float64 {
+	return w.Start + float64(i)*w.Interval
+}
+
+func (w *Waveform) Duration() float64 {
+	return float64(len(w.Samples)) * w.Interval
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package web
+
+import (
+	"fmt"
+	"github.com/frnckdlprt/hdsctl"
+	"strconv"
+)
+
+// generatorFields are the awg fields exchanged in volts and hertz, rather than in the firmware units
+var generatorFields = map[string]struct {
+	get func(g *hdsctl.Generator) (float64, error)
+	set func(g *hdsctl.Generator, v float64) error
+}{
+	"funcFreq": {(*hdsctl.Generator).Frequency, (*hdsctl.Generator).SetFrequency},
+	"funcAmpl": {(*hdsctl.Generator).Amplitude, (*hdsctl.Generator).SetAmplitude},
+	"funcOffs": {(*hdsctl.Generator).Offset, (*hdsctl.Generator).SetOffset},
+	"funcHigh": {(*hdsctl.Generator).High, (*hdsctl.Generator).SetHigh},
+	"funcLow":  {(*hdsctl.Generator).Low, (*hdsctl.Generator).SetLow},
+}
+
+func getGeneratorField(g *hdsctl.Generator, k string) (string, error) {
+	v, err := generatorFields[k].get(g)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatFloat(v, 'g', 6, 64), nil
+}
+
+func setGeneratorField(g *hdsctl.Generator, k, value string) error {
+	v, _, err := hdsctl.ParseValue(value)
+	if err != nil {
+		return fmt.Errorf("invalid value for %s: %w", k, err)
+	}
+	return generatorFields[k].set(g, v)
+}
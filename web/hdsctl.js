@@ -1,4 +1,34 @@
-function renderWaves(waves) {
+// persistence heatmap of the last binary message, drawn behind the waves
+let persistence = null;
+
+const persistenceColors = {1: [255, 255, 0], 2: [0, 128, 255]};
+
+// decodePersistence converts the binary stream of the persistence to an image, see persistence.WriteBinary
+function decodePersistence(buffer) {
+    let view = new DataView(buffer);
+    let w = view.getUint16(5, true);
+    let h = view.getUint16(7, true);
+    let channels = view.getUint8(9);
+    let img = new ImageData(w, h);
+    for (let i = 0; i < w * h; i++) {
+        img.data[i * 4 + 3] = 255;
+    }
+    let offset = 10;
+    for (let c = 0; c < channels; c++) {
+        let color = persistenceColors[view.getUint8(offset)] || [255, 255, 255];
+        offset++;
+        for (let i = 0; i < w * h; i++) {
+            let v = view.getUint8(offset + i) / 255;
+            for (let k = 0; k < 3; k++) {
+                img.data[i * 4 + k] = Math.min(255, img.data[i * 4 + k] + color[k] * v);
+            }
+        }
+        offset += w * h;
+    }
+    return img;
+}
+
+function renderWaves(waves, annotations) {
     let c = document.getElementById("myCanvas");
     let w = c.width;
     let h = c.height;
@@ -8,6 +38,9 @@ function renderWaves(waves) {
     let ctx = c.getContext("2d");
     ctx.fillStyle = "black";
     ctx.fillRect(0, 0, w, h);
+    if (persistence) {
+        ctx.putImageData(persistence, 0, 0);
+    }
     ctx.fillStyle = "white";
 
     for (let j = 0; j < h; j++) {
@@ -39,13 +72,98 @@ function renderWaves(waves) {
         }
         ctx.stroke();
     }
+
+    // decoded events, drawn as boxes at the bottom of the screen
+    ctx.font = "10px monospace";
+    ctx.lineWidth = 1;
+    for (var a of annotations || []) {
+        let x = a.x * w;
+        let aw = Math.max(2, a.w * w);
+        ctx.strokeStyle = a.error ? "red" : "lime";
+        ctx.strokeRect(x, h - 14, aw, 12);
+        ctx.fillStyle = a.error ? "red" : "lime";
+        ctx.fillText(a.text, x + 1, h - 4, aw);
+    }
+}
+
+// spectrum magnitudes in dBV, from -80dBV at the bottom to +20dBV at the top
+function renderSpectrum(spectrum) {
+    let c = document.getElementById("fftCanvas");
+    let w = c.width;
+    let h = c.height;
+    let ctx = c.getContext("2d");
+    ctx.fillStyle = "black";
+    ctx.fillRect(0, 0, w, h);
+    if (spectrum === "") {
+        return;
+    }
+    let values = spectrum.trim().split(" ");
+    ctx.beginPath();
+    ctx.strokeStyle = "magenta";
+    ctx.lineWidth = 1;
+    for (let i = 0; i < values.length; i++) {
+        let j = Math.min(h, Math.max(0, h * (20 - parseFloat(values[i])) / 100));
+        if (i == 0) {
+            ctx.moveTo(0, j);
+        } else {
+            ctx.lineTo(i * w / values.length, j);
+        }
+    }
+    ctx.stroke();
+}
+
+// bode plot of the measured points on a log frequency axis from the start to the stop frequency,
+// the gain from +20dB at the top to -60dB at the bottom, and the phase from +180° to -180°
+function renderBode(points) {
+    let c = document.getElementById("bodeCanvas");
+    let w = c.width;
+    let h = c.height;
+    let ctx = c.getContext("2d");
+    ctx.fillStyle = "black";
+    ctx.fillRect(0, 0, w, h);
+    let start = Math.log10(parseFloat(document.getElementById("bodeStart").value));
+    let stop = Math.log10(parseFloat(document.getElementById("bodeStop").value));
+    if (!(stop > start)) {
+        return;
+    }
+    let x = f => w * (Math.log10(f) - start) / (stop - start);
+    ctx.fillStyle = "gray";
+    for (let d = Math.ceil(start); d <= stop; d++) {
+        ctx.fillRect(x(Math.pow(10, d)), 0, 1, h);
+    }
+    for (let g = 0; g >= -60; g -= 20) {
+        ctx.fillRect(0, h * (20 - g) / 80, w, 1);
+    }
+    let traces = [{color: "lime", y: p => h * (20 - p.gain) / 80}, {color: "cyan", y: p => h * (180 - p.phase) / 360}];
+    for (let t of traces) {
+        ctx.beginPath();
+        ctx.strokeStyle = t.color;
+        ctx.lineWidth = 1;
+        for (let i = 0; i < points.length; i++) {
+            let y = Math.min(h, Math.max(0, t.y(points[i])));
+            if (i == 0) {
+                ctx.moveTo(x(points[i].frequency), y);
+            } else {
+                ctx.lineTo(x(points[i].frequency), y);
+            }
+        }
+        ctx.stroke();
+    }
 }
 
 window.addEventListener("load", function (evt) {
     let socket = new WebSocket("{{ .wsEndpoint }}");
+    socket.binaryType = "arraybuffer";
 
     socket.onmessage = event => {
+        if (event.data instanceof ArrayBuffer) {
+            persistence = decodePersistence(event.data);
+            return;
+        }
         fields = JSON.parse(event.data);
+        if (fields['persMode'] === "OFF") {
+            persistence = null;
+        }
         waves = [];
         if (fields['wave1']) {
             waves.push({data: fields['wave1'], color: 'yellow'});
@@ -53,8 +171,29 @@ window.addEventListener("load", function (evt) {
         if (fields['wave2']) {
             waves.push({data: fields['wave2'], color: 'blue'});
         }
+        // min of the envelope, whose max is the wave
+        if (fields['env1']) {
+            waves.push({data: fields['env1'], color: 'yellow'});
+        }
+        if (fields['env2']) {
+            waves.push({data: fields['env2'], color: 'blue'});
+        }
+        // tolerance band of the mask
+        if (fields['masku']) {
+            waves.push({data: fields['masku'], color: 'gray'});
+            waves.push({data: fields['maskl'], color: 'gray'});
+        }
+        if (fields['wavem']) {
+            waves.push({data: fields['wavem'], color: 'red'});
+        }
         if (waves.length>0) {
-            renderWaves(waves);
+            renderWaves(waves, fields['decode']);
+        }
+        if (fields['fft'] !== undefined) {
+            renderSpectrum(fields['fft']);
+        }
+        if (fields['bode'] !== undefined) {
+            renderBode(fields['bode']);
         }
         for (var k in fields) {
             if (k.endsWith(".range")) {
@@ -71,7 +210,7 @@ window.addEventListener("load", function (evt) {
             }
         }
         for (var k in fields) {
-            if (k === "wave1" || k === "wave2" || k.endsWith(".range")) {
+            if (k === "wave1" || k === "wave2" || k === "wavem" || k === "fft" || k === "decode" || k === "env1" || k === "env2" || k === "masku" || k === "maskl" || k === "bode" || k.endsWith(".range")) {
                 continue;
             }
             var value = fields[k];
@@ -81,12 +220,11 @@ window.addEventListener("load", function (evt) {
                 console.log("unknown element: ", k);
                 continue;
             }
-            if (["funcOffs","funcAmpl","funcLow", "funcHigh"].includes(k)) {
-                el.value = (parseFloat(value)/1000).toFixed(2);
-                continue;
+            if (k === "maskResult") {
+                el.style.color = value === "FAIL" ? "red" : "lime";
             }
-            if (["funcFreq"].includes(k)) {
-                el.value = (parseFloat(value)/1000000).toFixed(3);
+            if (el.tagName === "DIV") {
+                el.textContent = value;
                 continue;
             }
             el.value = value;
@@ -0,0 +1,545 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package web
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/frnckdlprt/hdsctl"
+	"github.com/frnckdlprt/hdsctl/decode"
+	"github.com/frnckdlprt/hdsctl/fft"
+	"github.com/frnckdlprt/hdsctl/fra"
+	"github.com/frnckdlprt/hdsctl/mask"
+	"github.com/frnckdlprt/hdsctl/mathchan"
+	"github.com/frnckdlprt/hdsctl/persistence"
+	"github.com/frnckdlprt/hdsctl/sweep"
+	"github.com/frnckdlprt/hdsctl/waveform"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// size of the persistence histogram, matching the screen canvas
+const persistenceWidth = 300
+const persistenceHeight = 200
+
+// traces are sent on every frame, the other data only when changed
+var traces = map[string]bool{"wave1": true, "wave2": true, "wavem": true, "fft": true, "fftPeak": true, "decode": true, "env1": true, "env2": true, "masku": true, "maskl": true}
+
+// processor computes the host side traces of a web interface connection
+type processor struct {
+	settings *settings
+	acc      *hdsctl.Accumulator
+	fftAvg   *fft.Averager
+	mathExpr *mathchan.Expr
+	lastErr  string
+	// math channel of the last frame, nil when off
+	mathWave *waveform.Waveform
+
+	// tolerance band of the reference frame, and the settings it was made with
+	mask      *mask.Mask
+	maskKey   string
+	maskStats mask.Stats
+
+	// persistence and its binary stream for the last frame, nil when off
+	persistence *persistence.Persistence
+	stream      []byte
+
+	// multimeter, and the settings last applied to it
+	dmm    *hdsctl.DMM
+	dmmKey string
+
+	// frequency response analysis, run in the background while the run setting is on, and the
+	// points and error it publishes for the poller
+	analyzer    *fra.Analyzer
+	bodeMx      sync.Mutex
+	bodeCancel  context.CancelFunc
+	bodeRunning bool
+	bodePoints  []fra.Point
+	bodeStatus  string
+	bodeErr     error
+}
+
+func newProcessor() *processor {
+	return &processor{settings: newSettings(), acc: &hdsctl.Accumulator{}, fftAvg: &fft.Averager{}}
+}
+
+func (p *processor) process(frame *hdsctl.Frame, data map[string]interface{}) {
+	p.log(p.maskTest(frame, data))
+	display, err := p.accumulate(frame, data)
+	p.log(err)
+	for ch, wav := range display.Waves {
+		data[fmt.Sprintf("wave%v", ch)] = rawValues(wav)
+	}
+	// the average is analysed in place of the frame, but not the envelope
+	if p.acc.Mode == hdsctl.AcquireAverage {
+		frame = display
+	}
+	p.log(p.math(frame, data))
+	p.log(p.spectrum(frame, data))
+	p.log(p.decode(frame, data))
+	p.log(p.persist(frame))
+}
+
+// persist accumulates the frame, and encodes the persistence as a binary stream sent along the data
+func (p *processor) persist(frame *hdsctl.Frame) error {
+	p.stream = nil
+	mode := p.settings.Get("persMode")
+	if mode == "OFF" {
+		p.persistence = nil
+		return nil
+	}
+	var decay time.Duration
+	if mode != "INF" {
+		var err error
+		decay, err = time.ParseDuration(mode)
+		if err != nil {
+			return err
+		}
+	}
+	if p.persistence == nil {
+		p.persistence = persistence.New(persistenceWidth, persistenceHeight, decay)
+	}
+	p.persistence.DecayTime = decay
+	p.persistence.Add(frame)
+	b := &bytes.Buffer{}
+	if err := p.persistence.WriteBinary(b); err != nil {
+		return err
+	}
+	p.stream = b.Bytes()
+	return nil
+}
+
+func rawValues(wav []int8) string {
+	vals := ""
+	for _, w := range wav {
+		vals += fmt.Sprintf("%v ", w)
+	}
+	return vals
+}
+
+// accumulate returns the frame to display in the host side acquisition mode: the running average,
+// or the max of the envelope whose min is sent as the env traces
+func (p *processor) accumulate(frame *hdsctl.Frame, data map[string]interface{}) (*hdsctl.Frame, error) {
+	data["env1"], data["env2"] = "", ""
+	data["acqFrames"] = ""
+	mode, err := hdsctl.ParseAcquireMode(p.settings.Get("acqHost"))
+	if err != nil {
+		return frame, err
+	}
+	if mode != p.acc.Mode {
+		p.acc.Reset()
+		p.acc.Mode = mode
+	}
+	if mode == hdsctl.AcquireSample {
+		return frame, nil
+	}
+	p.acc.Count, _ = strconv.Atoi(p.settings.Get("acqHostN"))
+	p.acc.Add(frame)
+	data["acqFrames"] = fmt.Sprintf("%v/%v frames", p.acc.Len(), p.acc.Count)
+	frames, err := p.acc.Frames()
+	if err != nil {
+		return frame, err
+	}
+	if mode == hdsctl.AcquireEnvelope {
+		for ch, wav := range frames[0].Waves {
+			data[fmt.Sprintf("env%v", ch)] = rawValues(wav)
+		}
+		return frames[1], nil
+	}
+	return frames[0], nil
+}
+
+// annotation is a decoded event placed on the screen, X and Width are fractions of the screen width
+type annotation struct {
+	X     float64 `json:"x"`
+	Width float64 `json:"w"`
+	Text  string  `json:"text"`
+	Error bool    `json:"error,omitempty"`
+}
+
+// decode sends the decoded events of the selected protocol as annotations of the waves
+func (p *processor) decode(frame *hdsctl.Frame, data map[string]interface{}) error {
+	annotations := []annotation{}
+	data["decode"] = annotations
+	proto := p.settings.Get("decProto")
+	if proto == "OFF" {
+		return nil
+	}
+	w, events, err := p.decodeEvents(proto, frame)
+	if err != nil || w == nil || w.Duration() <= 0 {
+		return err
+	}
+	duration := w.Duration()
+	for _, e := range events {
+		annotations = append(annotations, annotation{
+			X:     (e.Start - w.Start) / duration,
+			Width: (e.End - e.Start) / duration,
+			Text:  e.Text,
+			Error: e.Error != "",
+		})
+	}
+	data["decode"] = annotations
+	return nil
+}
+
+// decodeEvents returns the events of the protocol along with the waveform giving their time base,
+// which is nil when the source channels are not displayed
+func (p *processor) decodeEvents(proto string, frame *hdsctl.Frame) (*waveform.Waveform, []decode.Event, error) {
+	switch proto {
+	case "I2C":
+		// CH1 is SCL and CH2 is SDA
+		scl, err := displayedWaveform(frame, 1)
+		if scl == nil || err != nil {
+			return nil, nil, err
+		}
+		sda, err := displayedWaveform(frame, 2)
+		if sda == nil || err != nil {
+			return nil, nil, err
+		}
+		cfg, err := decode.ParseI2CMode(p.settings.Get("decMode"))
+		if err != nil {
+			return nil, nil, err
+		}
+		events, err := decode.I2C(scl, sda, cfg)
+		return scl, events, err
+	case "SPI":
+		// CH1 is SCLK and CH2 is MOSI or MISO
+		clk, err := displayedWaveform(frame, 1)
+		if clk == nil || err != nil {
+			return nil, nil, err
+		}
+		data, err := displayedWaveform(frame, 2)
+		if data == nil || err != nil {
+			return nil, nil, err
+		}
+		cfg := decode.DefaultSPIConfig()
+		mode, _ := strconv.Atoi(p.settings.Get("decSpiM"))
+		if err := cfg.SetMode(mode); err != nil {
+			return nil, nil, err
+		}
+		events, err := decode.SPI(clk, data, cfg)
+		return clk, events, err
+	}
+	// single channel protocols decode the source channel
+	w, err := p.source(frame, p.settings.Get("decChan"))
+	if w == nil || err != nil {
+		return nil, nil, err
+	}
+	switch proto {
+	case "1WIRE":
+		events, err := decode.OneWire(w, 0, 0)
+		return w, events, err
+	case "WS2812":
+		events, err := decode.WS2812(w, 0, 0)
+		return w, events, err
+	case "DHT11", "DHT22":
+		model, _ := decode.ParseDHTModel(proto)
+		events, err := decode.DHT(w, model, 0, 0)
+		return w, events, err
+	case "UART":
+		cfg := decode.DefaultUARTConfig()
+		if err := cfg.SetFormat(p.settings.Get("decFrame")); err != nil {
+			return nil, nil, err
+		}
+		if baud := p.settings.Get("decBaud"); baud != "" {
+			cfg.Baud, err = strconv.ParseFloat(baud, 64)
+			if err != nil {
+				p.settings.Set("decBaud", "")
+				return nil, nil, fmt.Errorf("invalid baud rate: %s", baud)
+			}
+		}
+		events, _, err := decode.UART(w, cfg)
+		return w, events, err
+	}
+	return nil, nil, fmt.Errorf("unknown protocol: %s", proto)
+}
+
+// displayedWaveform returns nil when the channel is not displayed
+func displayedWaveform(frame *hdsctl.Frame, ch int) (*waveform.Waveform, error) {
+	if _, ok := frame.Waves[ch]; !ok {
+		return nil, nil
+	}
+	return frame.Waveform(ch)
+}
+
+// source returns the waveform of a channel such as CH1, or of the math channel, nil when it is not displayed
+func (p *processor) source(frame *hdsctl.Frame, name string) (*waveform.Waveform, error) {
+	if name == "MATH" {
+		return p.mathWave, nil
+	}
+	ch, _ := strconv.Atoi(strings.TrimPrefix(name, "CH"))
+	return displayedWaveform(frame, ch)
+}
+
+// log does not repeat the same error on every frame
+func (p *processor) log(err error) {
+	if err != nil && err.Error() != p.lastErr {
+		log.Println(err)
+		p.lastErr = err.Error()
+	}
+}
+
+// math sends the math channel in screen units, using its own vertical scale per division
+func (p *processor) math(frame *hdsctl.Frame, data map[string]interface{}) error {
+	data["wavem"] = ""
+	p.mathWave = nil
+	src := p.settings.Get("mathExpr")
+	if src == "" {
+		return nil
+	}
+	if p.mathExpr == nil || p.mathExpr.String() != src {
+		e, err := mathchan.Parse(src)
+		if err != nil {
+			p.settings.Set("mathExpr", "")
+			return err
+		}
+		p.mathExpr = e
+	}
+	w, err := p.mathExpr.EvalFrame("MATH", frame)
+	if err != nil {
+		return err
+	}
+	p.mathWave = w
+	scale, _ := strconv.ParseFloat(p.settings.Get("mathScal"), 64)
+	vals := ""
+	for _, v := range w.Samples {
+		vals += fmt.Sprintf("%v ", math.Max(-127, math.Min(127, math.Round(v/scale*hdsctl.UnitsPerDivision))))
+	}
+	data["wavem"] = vals
+	return nil
+}
+
+func (p *processor) spectrum(frame *hdsctl.Frame, data map[string]interface{}) error {
+	data["fft"] = ""
+	data["fftPeak"] = ""
+	fftChan := p.settings.Get("fftChan")
+	if fftChan == "OFF" {
+		p.fftAvg.Reset()
+		return nil
+	}
+	w, err := p.source(frame, fftChan)
+	if w == nil || err != nil {
+		return err
+	}
+	window, err := fft.ParseWindow(p.settings.Get("fftWind"))
+	if err != nil {
+		return err
+	}
+	s, err := fft.Compute(w, window)
+	if err != nil {
+		return err
+	}
+	p.fftAvg.Count, _ = strconv.Atoi(p.settings.Get("fftAvg"))
+	p.fftAvg.Add(s)
+	s = p.fftAvg.Spectrum().DB()
+	vals := ""
+	for _, m := range s.Magnitudes {
+		vals += fmt.Sprintf("%.1f ", m)
+	}
+	data["fft"] = vals
+	if peaks := fft.Peaks(s, 1); len(peaks) > 0 {
+		data["fftPeak"] = fmt.Sprintf("%.4g Hz %.1f %s", peaks[0].Frequency, peaks[0].Magnitude, s.Unit)
+	}
+	return nil
+}
+
+// maskTest tests the frame against a tolerance band around the first frame of the mask channel, the band
+// is sent in screen units, and the band and statistics are reset when the mask settings change
+func (p *processor) maskTest(frame *hdsctl.Frame, data map[string]interface{}) error {
+	data["masku"], data["maskl"] = "", ""
+	data["maskResult"], data["maskStats"] = "", ""
+	src := p.settings.Get("maskChan")
+	if src == "OFF" {
+		p.mask = nil
+		return nil
+	}
+	ch, _ := strconv.Atoi(strings.TrimPrefix(src, "CH"))
+	w, err := displayedWaveform(frame, ch)
+	if w == nil || err != nil {
+		return err
+	}
+	hc, err := frame.Header.Channel(ch)
+	if err != nil {
+		return err
+	}
+	vpu, err := hc.VoltsPerUnit()
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf("%s %s %s", src, p.settings.Get("maskTolV"), p.settings.Get("maskTolH"))
+	if p.mask == nil || key != p.maskKey {
+		tolV, _ := strconv.ParseFloat(p.settings.Get("maskTolV"), 64)
+		tolH, _ := strconv.ParseFloat(p.settings.Get("maskTolH"), 64)
+		timeDiv, _, err := hdsctl.ParseValue(frame.Header.TimeBase.Scale)
+		if err != nil {
+			return err
+		}
+		p.mask = &mask.Mask{Bands: []*mask.Band{mask.NewBand(ch, w, tolV*vpu*hdsctl.UnitsPerDivision, tolH*timeDiv)}}
+		p.maskKey = key
+		p.maskStats = mask.Stats{}
+	}
+	r, err := p.mask.Test(frame)
+	if err != nil {
+		return err
+	}
+	p.maskStats.Add(r)
+	data["maskResult"] = "PASS"
+	if !r.Pass {
+		data["maskResult"] = "FAIL"
+	}
+	data["maskStats"] = p.maskStats.String()
+	lower, upper := p.mask.Bands[0].Bounds()
+	lvals, uvals := "", ""
+	for i := range lower {
+		lvals += fmt.Sprintf("%v ", math.Round(lower[i]/vpu+hc.Offset))
+		uvals += fmt.Sprintf("%v ", math.Round(upper[i]/vpu+hc.Offset))
+	}
+	data["maskl"], data["masku"] = lvals, uvals
+	return nil
+}
+
+// multimeter applies the multimeter settings when they change, and sends the reading and its statistics,
+// the multimeter is left alone when its mode is OFF
+func (p *processor) multimeter(data map[string]interface{}) error {
+	data["dmmMeas"], data["dmmStats"] = "", ""
+	mode := p.settings.Get("dmmMode")
+	if p.dmm == nil || mode == "OFF" {
+		p.dmmKey = ""
+		return nil
+	}
+	key := fmt.Sprintf("%s %s %s", mode, p.settings.Get("dmmRange"), p.settings.Get("dmmRel"))
+	if key != p.dmmKey {
+		m, err := hdsctl.ParseDMMMode(mode)
+		if err != nil {
+			return err
+		}
+		if err := p.dmm.SetMode(m); err != nil {
+			return err
+		}
+		if r := p.settings.Get("dmmRange"); r == "AUTO" {
+			err = p.dmm.Auto()
+		} else if m == hdsctl.VoltsDC || m == hdsctl.VoltsAC {
+			err = p.dmm.SetRange(r)
+		}
+		if err != nil {
+			return err
+		}
+		if err := p.dmm.SetRelative(p.settings.Get("dmmRel") == "ON"); err != nil {
+			return err
+		}
+		p.dmmKey = key
+	}
+	r, err := p.dmm.Read()
+	if err != nil {
+		return err
+	}
+	data["dmmMeas"] = r.String()
+	data["dmmStats"] = p.dmm.Stats().String()
+	return nil
+}
+
+// bode starts the frequency response analysis when the run setting is turned on, stops it when turned
+// off, and sends the points measured so far; a new analysis waits for the previous one to return
+func (p *processor) bode(data map[string]interface{}) error {
+	p.bodeMx.Lock()
+	defer p.bodeMx.Unlock()
+	if p.bodePoints != nil {
+		data["bode"] = append([]fra.Point{}, p.bodePoints...)
+		data["bodeStatus"] = p.bodeStatus
+	}
+	if p.bodeErr != nil {
+		p.log(p.bodeErr)
+		p.bodeErr = nil
+	}
+	if p.analyzer == nil || p.settings.Get("bodeRun") != "RUN" {
+		p.cancelBode()
+		return nil
+	}
+	if p.bodeRunning {
+		return nil
+	}
+	start, err := strconv.ParseFloat(p.settings.Get("bodeStart"), 64)
+	if err != nil {
+		p.settings.Set("bodeRun", "OFF")
+		return fmt.Errorf("invalid bode start frequency: %s", p.settings.Get("bodeStart"))
+	}
+	stop, err := strconv.ParseFloat(p.settings.Get("bodeStop"), 64)
+	if err != nil {
+		p.settings.Set("bodeRun", "OFF")
+		return fmt.Errorf("invalid bode stop frequency: %s", p.settings.Get("bodeStop"))
+	}
+	steps, _ := strconv.Atoi(p.settings.Get("bodeN"))
+	freqs, err := sweep.Points(start, stop, steps, true)
+	if err != nil {
+		p.settings.Set("bodeRun", "OFF")
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p.bodeCancel, p.bodeRunning = cancel, true
+	p.bodePoints, p.bodeStatus = []fra.Point{}, ""
+	go p.runBode(ctx, freqs)
+	return nil
+}
+
+// stopBode stops the frequency response analysis, if any, after the point being measured
+func (p *processor) stopBode() {
+	p.bodeMx.Lock()
+	defer p.bodeMx.Unlock()
+	p.cancelBode()
+}
+
+func (p *processor) cancelBode() {
+	if p.bodeCancel != nil {
+		p.bodeCancel()
+		p.bodeCancel = nil
+	}
+}
+
+// runBode measures the points of the frequency response one after the other and publishes them,
+// the run setting is turned off when the analysis is done or failed, but not when it was stopped
+func (p *processor) runBode(ctx context.Context, freqs []float64) {
+	err := p.analyzer.Setup()
+	for _, hz := range freqs {
+		if err != nil || ctx.Err() != nil {
+			break
+		}
+		var pt *fra.Point
+		if pt, err = p.analyzer.MeasureAt(hz); err != nil {
+			err = fmt.Errorf("failed to measure %.6g Hz: %w", hz, err)
+			break
+		}
+		p.bodeMx.Lock()
+		if ctx.Err() == nil {
+			p.bodePoints = append(p.bodePoints, *pt)
+			p.bodeStatus = fmt.Sprintf("%d/%d %.4g Hz %.1f dB %.0f°", len(p.bodePoints), len(freqs), hz, pt.Gain, pt.Phase)
+		}
+		p.bodeMx.Unlock()
+	}
+	p.bodeMx.Lock()
+	defer p.bodeMx.Unlock()
+	p.bodeRunning = false
+	if ctx.Err() == nil {
+		p.bodeErr = err
+		p.settings.Set("bodeRun", "OFF")
+		p.cancelBode()
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/frnckdlprt/hdsctl"
+	"github.com/frnckdlprt/hdsctl/fra"
 	"github.com/gorilla/websocket"
 	"log"
 	"net/http"
@@ -50,8 +51,24 @@ func wsEndpoint(hds *hdsctl.HDS, w http.ResponseWriter, r *http.Request) {
 	ws, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println(err)
+		return
 	}
+	// closing the connection when the client is gone makes the poller writes fail, which stops it
+	defer ws.Close()
 	mx := sync.Mutex{}
+	write := func(messageType int, data []byte) error {
+		mx.Lock()
+		defer mx.Unlock()
+		return ws.WriteMessage(messageType, data)
+	}
+	proc := newProcessor()
+	proc.dmm = hdsctl.NewDMM(hds)
+	gen := hdsctl.NewGenerator(hds)
+	proc.analyzer, err = fra.NewAnalyzer(hds, fra.Options{Dwell: 200 * time.Millisecond})
+	if err != nil {
+		log.Println(err)
+	}
+	defer proc.stopBode()
 
 	go func() {
 
@@ -61,18 +78,21 @@ func wsEndpoint(hds *hdsctl.HDS, w http.ResponseWriter, r *http.Request) {
 			c = c + 1
 			time.Sleep(250 * time.Millisecond)
 			data := map[string]interface{}{}
-			hds.GetField("datWavScrHead")
-			for i := 1; i <= 2; i++ {
-				chDisp, _ := hds.GetField(fmt.Sprintf("ch%vDisp", i))
-				if chDisp == "ON" {
-					wav, _ := hds.Client.GetWave(i)
-					vals := ""
-					for _, w := range wav {
-						vals += fmt.Sprintf("%v ", int8(w))
+			frame, err := hds.Acquire()
+			if err != nil {
+				log.Println(err)
+			} else {
+				proc.process(frame, data)
+				if proc.stream != nil {
+					if err := write(websocket.BinaryMessage, proc.stream); err != nil {
+						log.Println(err)
+						return
 					}
-					data[fmt.Sprintf("wave%v", i)] = vals
 				}
 			}
+			proc.log(proc.multimeter(data))
+			proc.log(proc.bode(data))
+			proc.settings.AddTo(data)
 			var fields []string
 
 			if c%8 != 0 {
@@ -87,7 +107,6 @@ func wsEndpoint(hds *hdsctl.HDS, w http.ResponseWriter, r *http.Request) {
 					"func", "funcOffs", "chan", "funcFreq", "funcAmpl", "funcLow", "funcHigh",
 					"trigSingSour", "trigSingCoup", "trigSingEdg", "trigSingSwe", "trigSingEdgLev",
 				}
-				//"dmmMeas"}
 			}
 
 			for _, f := range fields {
@@ -96,7 +115,11 @@ func wsEndpoint(hds *hdsctl.HDS, w http.ResponseWriter, r *http.Request) {
 					log.Printf("unknown field: %s\n", f)
 					continue
 				}
-				data[f], _ = hds.GetField(f)
+				if _, ok := generatorFields[f]; ok {
+					data[f], _ = getGeneratorField(gen, f)
+				} else {
+					data[f], _ = hds.GetField(f)
+				}
 
 				if cd.ValueRange != nil && !strings.HasPrefix(f, "dmm") {
 					data[fmt.Sprintf("%s.range", f)] = cd.ValueRange
@@ -104,7 +127,7 @@ func wsEndpoint(hds *hdsctl.HDS, w http.ResponseWriter, r *http.Request) {
 			}
 			dataUpdate := map[string]interface{}{}
 			for k, v := range data {
-				if k == "wave1" || k == "wave2" {
+				if traces[k] {
 					dataUpdate[k] = v
 					continue
 				}
@@ -117,9 +140,10 @@ func wsEndpoint(hds *hdsctl.HDS, w http.ResponseWriter, r *http.Request) {
 				if err != nil {
 					log.Println(err)
 				}
-				mx.Lock()
-				ws.WriteMessage(websocket.TextMessage, msg)
-				mx.Unlock()
+				if err := write(websocket.TextMessage, msg); err != nil {
+					log.Println(err)
+					return
+				}
 			}
 			lastdata = data
 		}
@@ -131,16 +155,32 @@ func wsEndpoint(hds *hdsctl.HDS, w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		//log.Println("Received ", p)
-		parts := strings.Split(string(p), ":")
-		param := strings.TrimSpace(parts[0])
-		value := strings.TrimSpace(parts[1])
-		err = hds.SetField(param, value)
-		if err != nil {
-			log.Println(err)
-		}
-		realv, err := hds.GetField(param)
-		if err != nil {
-			log.Println(err)
+		param, value, _ := strings.Cut(string(p), ":")
+		param = strings.TrimSpace(param)
+		value = strings.TrimSpace(value)
+		var realv string
+		if _, ok := generatorFields[param]; ok {
+			if err := setGeneratorField(gen, param, value); err != nil {
+				log.Println(err)
+			}
+			realv, err = getGeneratorField(gen, param)
+			if err != nil {
+				log.Println(err)
+			}
+		} else if proc.settings.Has(param) {
+			if err := proc.settings.Set(param, value); err != nil {
+				log.Println(err)
+			}
+			realv = proc.settings.Get(param)
+		} else {
+			err = hds.SetField(param, value)
+			if err != nil {
+				log.Println(err)
+			}
+			realv, err = hds.GetField(param)
+			if err != nil {
+				log.Println(err)
+			}
 		}
 		//log.Printf("ui: %v real: %v\n", value, realv)
 
@@ -150,13 +190,10 @@ func wsEndpoint(hds *hdsctl.HDS, w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			log.Println(err)
 		}
-		mx.Lock()
-		if err := ws.WriteMessage(websocket.TextMessage, msg); err != nil {
+		if err := write(websocket.TextMessage, msg); err != nil {
 			log.Println(err)
-			mx.Unlock()
 			return
 		}
-		mx.Unlock()
 	}
 }
 
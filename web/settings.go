@@ -0,0 +1,134 @@
+/*
+Copyright 2023 frnckdlprt.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package web
+
+import (
+	"fmt"
+	"github.com/frnckdlprt/hdsctl/fft"
+	"sync"
+)
+
+// host side settings of the web interface, which are not scope fields, with their range if any
+var settingRanges = map[string][]string{
+	"acqHost":  {"SAMPLE", "AVERAGE", "ENVELOPE"},
+	"acqHostN": {"2", "4", "8", "16", "32", "64", "128"},
+	"persMode": {"OFF", "500ms", "1s", "2s", "5s", "10s", "INF"},
+	"maskChan": {"OFF", "CH1", "CH2"},
+	"maskTolV": {"0.1", "0.2", "0.5", "1"},
+	"maskTolH": {"0", "0.1", "0.2", "0.5"},
+	"fftChan":  {"OFF", "CH1", "CH2", "MATH"},
+	"fftWind":  fft.WindowNames(),
+	"fftAvg":   {"1", "4", "16"},
+	"decProto": {"OFF", "UART", "I2C", "SPI", "1WIRE", "WS2812", "DHT11", "DHT22"},
+	"decSpiM":  {"0", "1", "2", "3"},
+	"decFrame": {"AUTO", "8N1", "8E1", "8O1", "8N2", "7E1", "7O1", "7N1", "9N1"},
+	"decMode":  {"standard", "fast", "none"},
+	"decChan":  {"CH1", "CH2", "MATH"},
+	"dmmMode":  {"OFF", "DCV", "ACV", "DCA", "ACA", "R", "CONT", "DIODE", "C"},
+	"dmmRange": {"AUTO", "mV", "V"},
+	"dmmRel":   {"OFF", "ON"},
+	"bodeRun":  {"OFF", "RUN"},
+	"bodeN":    {"11", "21", "31", "51"},
+	"mathScal": {"0.01", "0.02", "0.05", "0.1", "0.2", "0.5", "1", "2", "5", "10", "20", "50", "100", "200", "500", "1000"},
+}
+
+var settingDefaults = map[string]string{
+	"acqHost":  "SAMPLE",
+	"acqHostN": "16",
+	"persMode": "OFF",
+	// tolerances of the mask band, in divisions
+	"maskChan": "OFF",
+	"maskTolV": "0.2",
+	"maskTolH": "0.1",
+	"fftChan":  "OFF",
+	"fftWind":  "hann",
+	"fftAvg":   "1",
+	// free text math channel expression, such as CH1-CH2
+	"mathExpr": "",
+	"mathScal": "1",
+	"decProto": "OFF",
+	"decChan":  "CH1",
+	"decMode":  "standard",
+	"decSpiM":  "0",
+	"decFrame": "8N1",
+	// free text baud rate, detected when empty
+	"decBaud": "",
+	// frequency response analysis, from and to free text frequencies in hertz
+	"bodeRun":   "OFF",
+	"bodeStart": "10",
+	"bodeStop":  "100000",
+	"bodeN":     "21",
+	// the multimeter is only polled, and configured, when a mode is selected
+	"dmmMode":  "OFF",
+	"dmmRange": "AUTO",
+	"dmmRel":   "OFF",
+}
+
+type settings struct {
+	mx     sync.Mutex
+	values map[string]string
+}
+
+func newSettings() *settings {
+	s := &settings{values: map[string]string{}}
+	for k, v := range settingDefaults {
+		s.values[k] = v
+	}
+	return s
+}
+
+func (s *settings) Has(k string) bool {
+	_, ok := settingDefaults[k]
+	return ok
+}
+
+func (s *settings) Get(k string) string {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.values[k]
+}
+
+func (s *settings) Set(k, v string) error {
+	if !s.Has(k) {
+		return fmt.Errorf("invalid setting: %s", k)
+	}
+	if r, ok := settingRanges[k]; ok {
+		valid := false
+		for _, rv := range r {
+			valid = valid || rv == v
+		}
+		if !valid {
+			return fmt.Errorf("invalid value for %s: %s", k, v)
+		}
+	}
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.values[k] = v
+	return nil
+}
+
+// AddTo adds the settings values and ranges to the data sent to the web interface
+func (s *settings) AddTo(data map[string]interface{}) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	for k, v := range s.values {
+		data[k] = v
+		if r, ok := settingRanges[k]; ok {
+			data[fmt.Sprintf("%s.range", k)] = r
+		}
+	}
+}